@@ -0,0 +1,114 @@
+package main
+
+import (
+	"errors"
+	"slices"
+
+	"github.com/maxsupermanhd/lac/v2"
+)
+
+var (
+	errInviteCodeNotFound = errors.New("invite code not found")
+	errInviteCodeUsed     = errors.New("invite code already used")
+)
+
+func (a *instanceAccess) allowed(pubkeyB64, hash string, account *int) bool {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if slices.Contains(a.Pubkeys, pubkeyB64) || slices.Contains(a.Hashes, hash) {
+		return true
+	}
+	return account != nil && slices.Contains(a.Accounts, *account)
+}
+
+func (a *instanceAccess) redeem(code, hash string) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	r, ok := a.InviteCodes[code]
+	if !ok {
+		return errInviteCodeNotFound
+	}
+	if r != "" && r != hash {
+		return errInviteCodeUsed
+	}
+	a.InviteCodes[code] = hash
+	if !slices.Contains(a.Hashes, hash) {
+		a.Hashes = append(a.Hashes, hash)
+	}
+	return nil
+}
+
+func (a *instanceAccess) unusedInviteCodes() []string {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	ret := []string{}
+	for k, v := range a.InviteCodes {
+		if v == "" {
+			ret = append(ret, k)
+		}
+	}
+	slices.Sort(ret)
+	return ret
+}
+
+// parses "private" section of room request, nil if room is public
+func accessFromRequest(c lac.Conf) *instanceAccess {
+	if _, ok := c.Get("private"); !ok {
+		return nil
+	}
+	a := &instanceAccess{
+		Pubkeys:         []string{},
+		Hashes:          c.GetDSliceString([]string{}, "private", "hashes"),
+		Accounts:        c.GetDSliceInt([]int{}, "private", "accounts"),
+		InviteCodes:     map[string]string{},
+		AllowSpectators: c.GetDBool(false, "private", "allowSpectators"),
+	}
+	for range min(c.GetDInt(0, "private", "inviteCodes"), 64) {
+		a.InviteCodes[genSecureRandomString(8)] = ""
+	}
+	return a
+}
+
+// recovery json is written by the runner, it owns the instance
+func redeemInviteCode(code, hash string) (*instance, error) {
+	instancesLock.Lock()
+	var found *instance
+	var err error
+	for _, inst := range instances {
+		if inst.Access == nil || instanceState(inst.state.Load()) > instanceStateInLobby {
+			continue
+		}
+		err = inst.Access.redeem(code, hash)
+		if errors.Is(err, errInviteCodeNotFound) {
+			continue
+		}
+		found = inst
+		break
+	}
+	instancesLock.Unlock()
+	if found == nil {
+		return nil, errInviteCodeNotFound
+	}
+	if err == nil {
+		sendInstanceCommand(found.Id, instanceCommand{command: icRecoverSave})
+	}
+	return found, err
+}
+
+func instanceChatCommandHandlerInvite(inst *instance, args string, e chatCommandExecutor) {
+	lang := msgPlayerLang(inst, e.publicKeyB64)
+	if inst.Access == nil {
+		instWriteFmt(inst, `chat direct %s %s`, e.publicKeyB64, msgT(inst, lang, "invite.notUsed"))
+		return
+	}
+	err := inst.Access.redeem(args, e.hash)
+	if err != nil {
+		instWriteFmt(inst, `chat direct %s %s`, e.publicKeyB64, msgT(inst, lang, "invite.failed", "error", err.Error()))
+		return
+	}
+	err = recoverSave(inst)
+	if err != nil {
+		inst.logger.Printf("Failed to save instance recovery json: %s", err.Error())
+	}
+	instWriteFmt(inst, `chat direct %s %s`, e.publicKeyB64, msgT(inst, lang, "invite.accepted"))
+}
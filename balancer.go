@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math"
+	"math/bits"
+	"slices"
+	"strings"
+)
+
+type balancerPlayer struct {
+	pubkeyB64 string
+	name      string
+	index     int
+	rating    float64
+}
+
+func balancerOnReadyStatus(inst *instance, ready bool, playerIndex int, pubkeyB64 string) {
+	if ready {
+		inst.readyPlayers[pubkeyB64] = playerIndex
+	} else {
+		delete(inst.readyPlayers, pubkeyB64)
+	}
+	if !tryCfgGetD(tryGetBoolGen("balanceTeams", "enabled"), false, inst.cfgs...) {
+		return
+	}
+	if inst.Settings.PlayerCount%2 != 0 || instanceState(inst.state.Load()) != instanceStateInLobby {
+		return
+	}
+	players := balancerCollectPlayers(inst)
+	if players == nil {
+		return
+	}
+	category := tryCfgGetD(tryGetIntGen("balanceTeams", "ratingCategory"), -1, inst.cfgs...)
+	if category == -1 {
+		if len(inst.Settings.RatingCategories) == 0 {
+			inst.logger.Println("balancer has no rating category to use")
+			return
+		}
+		category = inst.Settings.RatingCategories[0]
+	}
+	for _, p := range players {
+		pk, err := base64.StdEncoding.DecodeString(p.pubkeyB64)
+		if err != nil {
+			inst.logger.Printf("balancer failed to decode pubkey: %s", err.Error())
+			return
+		}
+		p.rating, _ = ratingLookup(category, pk)
+	}
+	teamA, teamB := balancerSplit(players)
+	assignment := map[string]int{}
+	for _, p := range teamA {
+		assignment[p.pubkeyB64] = 0
+	}
+	for _, p := range teamB {
+		assignment[p.pubkeyB64] = 1
+	}
+	signature := balancerAssignmentSignature(assignment)
+	if signature == inst.balanceApplied {
+		return
+	}
+	inst.balanceApplied = signature
+	avgA, avgB := balancerAverage(teamA), balancerAverage(teamB)
+	// host has no known command to change teams, teams follow slots from
+	// preset, so without configured command players only get a suggestion
+	cmdFmt := tryCfgGetD(tryGetStringGen("balanceTeams", "teamCommand"), "", inst.cfgs...)
+	if cmdFmt == "" {
+		inst.logger.Printf("balancer has no teamCommand configured, suggesting teams with averages %.1f vs %.1f", avgA, avgB)
+		instWriteFmt(inst, `chat bcast %s`, msgT(inst, msgRoomLang(inst), "balance.suggested",
+			"teamA", balancerNames(teamA), "ratingA", fmt.Sprintf("%.0f", avgA),
+			"teamB", balancerNames(teamB), "ratingB", fmt.Sprintf("%.0f", avgB),
+			"chance", fmt.Sprintf("%.0f", ratingEloExpected(avgA, avgB)*100)))
+		return
+	}
+	for _, p := range players {
+		instWriteFmt(inst, "%s", strings.NewReplacer(
+			"{index}", fmt.Sprint(p.index),
+			"{team}", fmt.Sprint(assignment[p.pubkeyB64]),
+		).Replace(cmdFmt))
+	}
+	inst.logger.Printf("balancer sent team commands with averages %.1f vs %.1f", avgA, avgB)
+	instWriteFmt(inst, `chat bcast %s`, msgT(inst, msgRoomLang(inst), "balance.applied",
+		"ratingA", fmt.Sprintf("%.0f", avgA), "ratingB", fmt.Sprintf("%.0f", avgB),
+		"chance", fmt.Sprintf("%.0f", ratingEloExpected(avgA, avgB)*100)))
+}
+
+func balancerNames(team []*balancerPlayer) string {
+	names := []string{}
+	for _, p := range team {
+		names = append(names, p.name)
+	}
+	return strings.Join(names, ", ")
+}
+
+// returns nil if room is not full or somebody is not ready
+func balancerCollectPlayers(inst *instance) []*balancerPlayer {
+	pl, ok := inst.RoomStatus.GetSliceAny("players")
+	if !ok {
+		return nil
+	}
+	ret := []*balancerPlayer{}
+	for _, v := range pl {
+		p, ok := v.(map[string]any)
+		if !ok {
+			continue
+		}
+		if t, _ := p["type"].(string); t != "player" {
+			continue
+		}
+		pk, ok := p["pk"].(string)
+		if !ok {
+			return nil
+		}
+		index, ready := inst.readyPlayers[pk]
+		if !ready {
+			return nil
+		}
+		name, _ := p["name"].(string)
+		ret = append(ret, &balancerPlayer{pubkeyB64: pk, name: name, index: index})
+	}
+	if len(ret) != inst.Settings.PlayerCount {
+		return nil
+	}
+	slices.SortFunc(ret, func(a, b *balancerPlayer) int {
+		return a.index - b.index
+	})
+	return ret
+}
+
+// brute force over all halves, room has at most 10 players so it is cheap
+func balancerSplit(players []*balancerPlayer) (teamA, teamB []*balancerPlayer) {
+	n := len(players)
+	best := math.Inf(1)
+	bestMask := 0
+	for mask := 0; mask < 1<<n; mask++ {
+		// first player is always in team A to skip mirrored splits
+		if mask&1 == 0 || bits.OnesCount(uint(mask)) != n/2 {
+			continue
+		}
+		sumA, sumB := 0.0, 0.0
+		for i, p := range players {
+			if mask&(1<<i) != 0 {
+				sumA += p.rating
+			} else {
+				sumB += p.rating
+			}
+		}
+		diff := math.Abs(sumA - sumB)
+		if diff < best {
+			best = diff
+			bestMask = mask
+		}
+	}
+	for i, p := range players {
+		if bestMask&(1<<i) != 0 {
+			teamA = append(teamA, p)
+		} else {
+			teamB = append(teamB, p)
+		}
+	}
+	return
+}
+
+func balancerAverage(team []*balancerPlayer) float64 {
+	if len(team) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, p := range team {
+		sum += p.rating
+	}
+	return sum / float64(len(team))
+}
+
+func balancerAssignmentSignature(assignment map[string]int) string {
+	keys := make([]string, 0, len(assignment))
+	for k := range assignment {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	ret := ""
+	for _, k := range keys {
+		ret += fmt.Sprintf("%s=%d;", k, assignment[k])
+	}
+	return ret
+}
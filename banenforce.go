@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"maps"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// who ban applies to when looking at players in rooms and what it forbids
+type banTarget struct {
+	eventID         string
+	reason          string
+	active          bool
+	expires         string
+	forbidsJoining  bool
+	forbidsPlaying  bool
+	forbidsChatting bool
+	hashes          []string
+	network         *net.IPNet
+}
+
+var (
+	banEnforcedLock sync.Mutex
+	banEnforced     = map[string]banEnforcedEntry{}
+)
+
+type banEnforcedEntry struct {
+	signature string
+	when      time.Time
+}
+
+func banLoadTarget(eventID string) (*banTarget, error) {
+	table, id, err := banTableFromEventID(eventID)
+	if err != nil {
+		return nil, err
+	}
+	t := &banTarget{eventID: eventID, hashes: []string{}}
+	err = dbpool.QueryRow(context.Background(), `select
+	reason, time_expires is null or time_expires > now(), coalesce(time_expires::text, ''), forbids_joining, forbids_playing, forbids_chatting
+from `+table+`
+where id = $1`, id).Scan(&t.reason, &t.active, &t.expires, &t.forbidsJoining, &t.forbidsPlaying, &t.forbidsChatting)
+	if err != nil {
+		return nil, err
+	}
+	if table == "ip_bans" {
+		var network string
+		err = dbpool.QueryRow(context.Background(), `select network::text from ip_bans where id = $1`, id).Scan(&network)
+		if err != nil {
+			return nil, err
+		}
+		_, t.network, err = net.ParseCIDR(network)
+		return t, err
+	}
+	var hash string
+	_, err = dbpool.QueryFunc(context.Background(), `select i.hash
+from bans as b
+join identities as i on i.id = b.identity or i.account = b.account
+where b.id = $1`, []any{id}, []any{&hash}, func(_ pgx.QueryFuncRow) error {
+		t.hashes = append(t.hashes, hash)
+		return nil
+	})
+	return t, err
+}
+
+// changes when ban is edited or extended so it gets enforced again
+func banSignature(expires string, joining, playing, chatting bool) string {
+	return fmt.Sprintf("%s %v %v %v", expires, joining, playing, chatting)
+}
+
+func (t *banTarget) matches(hash, ip string) bool {
+	if slices.Contains(t.hashes, hash) {
+		return true
+	}
+	if t.network != nil {
+		clip := net.ParseIP(ip)
+		return clip != nil && t.network.Contains(clip)
+	}
+	return false
+}
+
+func banKickReason(inst *instance, lang, reason, eventID string) string {
+	return msgT(inst, lang, "kick.banned", "reason", strings.ReplaceAll(reason, "\n", " "),
+		"appeal", msgT(inst, lang, "reject.appeal"), "event", eventID)
+}
+
+// acts on every player matching the ban in running rooms: kicks when joining
+// is forbidden, mutes when chatting is forbidden and moves to spectators when
+// playing is forbidden (kicks instead if game already started or there is no
+// "specCommand"), returns number of players acted on, does nothing if ban
+// was already enforced with same expiry and restrictions
+func banEnforce(eventID string) (int, error) {
+	t, err := banLoadTarget(eventID)
+	if err != nil {
+		return 0, err
+	}
+	if !t.active {
+		return 0, nil
+	}
+	if !banEnforcedMark(eventID, banSignature(t.expires, t.forbidsJoining, t.forbidsPlaying, t.forbidsChatting)) {
+		return 0, nil
+	}
+	type banAction struct {
+		inst int64
+		d    instanceCommandBanEnforce
+	}
+	actions := []banAction{}
+	instancesLock.Lock()
+	for _, inst := range instances {
+		state := instanceState(inst.state.Load())
+		if state >= instanceStateExiting {
+			continue
+		}
+		canSpec := tryCfgGetD(tryGetStringGen("banEnforcement", "specCommand"), "", inst.cfgs...) != ""
+		players := roomStatusPlayersOfType(inst.RoomStatus, "")
+		ipCount := map[string]int{}
+		for _, p := range players {
+			if ip, _ := p["ip"].(string); ip != "" {
+				ipCount[ip]++
+			}
+		}
+		for _, p := range players {
+			pk, _ := p["pk"].(string)
+			ip, _ := p["ip"].(string)
+			pkb, err := base64.StdEncoding.DecodeString(pk)
+			if err != nil || ip == "" || !t.matches(pubkeyHash(pkb), ip) {
+				continue
+			}
+			isPlayer := p["type"] == "player"
+			d := instanceCommandBanEnforce{
+				pubkeyB64: pk,
+				ip:        ip,
+				sharedIP:  ipCount[ip] > 1,
+				kick:      t.forbidsJoining || (t.forbidsPlaying && isPlayer && (state == instanceStateInGame || !canSpec)),
+				mute:      t.forbidsChatting,
+				reason:    banKickReason(inst, msgRoomLang(inst), t.reason, eventID),
+				eventID:   eventID,
+			}
+			d.spec = !d.kick && t.forbidsPlaying && isPlayer
+			d.index, _ = anyToInt(p["pos"])
+			if !d.kick && !d.spec && !d.mute {
+				continue
+			}
+			actions = append(actions, banAction{inst: inst.Id, d: d})
+		}
+	}
+	instancesLock.Unlock()
+	enforced := 0
+	for _, a := range actions {
+		if sendInstanceCommand(a.inst, instanceCommand{command: icBanEnforce, data: a.d}) {
+			enforced++
+		}
+	}
+	return enforced, nil
+}
+
+// runs in runner loop
+//
+// kick goes through "kickCommand" ({index}, {pubkey} and {reason} are
+// substituted), without it player is kicked by ip ban that is lifted right
+// away, which is skipped when someone else in the room has same address
+// (NAT), such player is muted and told to leave instead
+func banEnforceInRoom(inst *instance, d instanceCommandBanEnforce) {
+	inst.logger.Printf("enforcing ban %s on %s (%s): kick %v spec %v mute %v", d.eventID, d.pubkeyB64, d.ip, d.kick, d.spec, d.mute)
+	lang := msgPlayerLang(inst, d.pubkeyB64)
+	if d.kick {
+		kickFmt := tryCfgGetD(tryGetStringGen("banEnforcement", "kickCommand"), "", inst.cfgs...)
+		switch {
+		case kickFmt != "":
+			instWriteFmt(inst, "%s", banEnforceReplacer(d).Replace(kickFmt))
+			return
+		case !d.sharedIP:
+			instWriteFmt(inst, `ban ip %s %s`, d.ip, d.reason)
+			instWriteFmt(inst, `unban ip %s`, d.ip)
+			return
+		}
+		inst.logger.Printf("not kicking %s for ban %s, address %s is shared with other players", d.pubkeyB64, d.eventID, d.ip)
+		instWriteFmt(inst, `set chat mute %s`, d.pubkeyB64)
+		instWriteFmt(inst, `chat direct %s %s`, d.pubkeyB64, msgT(inst, lang, "join.bannedLeave", "event", d.eventID))
+		return
+	}
+	if d.mute {
+		instWriteFmt(inst, `set chat mute %s`, d.pubkeyB64)
+		instWriteFmt(inst, `chat direct %s %s`, d.pubkeyB64, msgT(inst, lang, "join.bannedChat", "event", d.eventID))
+	}
+	if d.spec {
+		cmdFmt := tryCfgGetD(tryGetStringGen("banEnforcement", "specCommand"), "", inst.cfgs...)
+		instWriteFmt(inst, "%s", banEnforceReplacer(d).Replace(cmdFmt))
+		instWriteFmt(inst, `chat direct %s %s`, d.pubkeyB64, msgT(inst, lang, "join.bannedPlay", "event", d.eventID))
+	}
+}
+
+func banEnforceReplacer(d instanceCommandBanEnforce) *strings.Replacer {
+	return strings.NewReplacer("{index}", fmt.Sprint(d.index), "{pubkey}", d.pubkeyB64, "{reason}", d.reason)
+}
+
+// returns false if ban was already enforced recently with same signature
+func banEnforcedMark(eventID, signature string) bool {
+	banEnforcedLock.Lock()
+	defer banEnforcedLock.Unlock()
+	maps.DeleteFunc(banEnforced, func(_ string, v banEnforcedEntry) bool {
+		return time.Since(v.when) > time.Hour
+	})
+	if e, ok := banEnforced[eventID]; ok && e.signature == signature {
+		return false
+	}
+	banEnforced[eventID] = banEnforcedEntry{signature: signature, when: time.Now()}
+	return true
+}
+
+// polls active bans and enforces ones that are new, edited or extended
+// outside of backend (website, sql)
+func routineBanEnforcement(closechan <-chan struct{}) {
+	known := map[string]map[string]string{}
+	for {
+		select {
+		case <-closechan:
+			return
+		case <-time.After(time.Duration(cfg.GetDInt(15, "banEnforcement", "pollIntervalSeconds")) * time.Second):
+		}
+		if !cfg.GetDBool(true, "banEnforcement", "enabled") {
+			continue
+		}
+		for table, prefix := range map[string]string{"bans": "M-", "ip_bans": "I-"} {
+			active := map[string]string{}
+			var (
+				id                         int
+				expires                    string
+				joining, playing, chatting bool
+			)
+			_, err := dbpool.QueryFunc(context.Background(), `select id, coalesce(time_expires::text, ''), forbids_joining, forbids_playing, forbids_chatting
+from `+table+`
+where time_expires is null or time_expires > now()`, []any{}, []any{&id, &expires, &joining, &playing, &chatting}, func(_ pgx.QueryFuncRow) error {
+				active[fmt.Sprintf("%s%d", prefix, id)] = banSignature(expires, joining, playing, chatting)
+				return nil
+			})
+			if err != nil {
+				log.Printf("Failed to poll active %s: %s", table, err.Error())
+				continue
+			}
+			prev, ok := known[table]
+			known[table] = active
+			if !ok {
+				continue
+			}
+			for eventID, sig := range active {
+				if prev[eventID] == sig {
+					continue
+				}
+				n, err := banEnforce(eventID)
+				if err != nil {
+					log.Printf("Failed to enforce ban %s: %s", eventID, err.Error())
+					continue
+				}
+				if n > 0 {
+					log.Printf("Enforced ban %s on %d players", eventID, n)
+				}
+			}
+		}
+	}
+}
@@ -7,9 +7,31 @@ const (
 	icShutdown
 	icBroadcast
 	icRunnerStop
+	icDirectMessage
+	icMapVoteEnd
+	icMapVoteFailed
+	icBanEnforce
+	icRecoverSave
 )
 
 type instanceCommand struct {
 	command instanceCommandType
 	data    any
 }
+
+type instanceCommandDirectMessage struct {
+	pubkeyB64 string
+	message   string
+}
+
+type instanceCommandBanEnforce struct {
+	pubkeyB64 string
+	ip        string
+	sharedIP  bool
+	index     int
+	kick      bool
+	spec      bool
+	mute      bool
+	reason    string
+	eventID   string
+}
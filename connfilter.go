@@ -1,260 +1,257 @@
 package main
 
 import (
+	"autohoster-backend/ispcheck"
 	"context"
+	"encoding/base64"
 	"errors"
-	"fmt"
 	"log"
 	"net"
 	"slices"
-	"strconv"
 	"strings"
 	"sync"
 	"time"
 
-	"github.com/jackc/pgx/v4"
 	"github.com/maxsupermanhd/lac/v2"
 )
 
-var (
-	rejectContactMsg = "You can contact Autohoster administration to appeal or get additional information: https://wz2100-autohost.net/about#contact\\n\\n"
-)
-
 // approve approvespec reject ban
-func joinCheck(inst *instance, ip string, name string, pubkey []byte, pubkeyB64 string) (jd joinDispatch, action joinCheckActionLevel, reason string) {
-	jd.Issued = time.Now()
-	jd.Messages = []string{}
-	jd.AllowChat = true
-	action = joinCheckActionLevelApprove
-
-	// dolf/spam protection
-	if stringContainsSlices(strings.ToLower(name), tryCfgGetD(tryGetSliceStringGen("blacklist", "name"), []string{}, inst.cfgs...)) {
-		ecode, err := DbLogAction("%d [adolfmeasures] Join name %s triggered adolf suppression system, ip was %s", inst.Id, name, ip)
-		if err != nil {
-			inst.logger.Printf("Failed to log action in database: %s", err.Error())
-		}
-		return jd, joinCheckActionLevelBan, "You were banned from joining Autohoster.\\n" +
-			"Ban reason: 4.1.7. Any manifestations of Nazism, nationalism, incitement " +
-			"of interracial, interethnic, interfaith discord and hostility, " +
-			"calls for the overthrow of the government by force.\\n\\n" + rejectContactMsg +
-			"Event ID: " + ecode
-	}
+func joinCheck(inst *instance, ip string, name string, pubkey []byte, pubkeyB64 string) joinCheckResult {
+	r := joinCheckEvaluate(inst, ip, name, pubkey, pubkeyB64, false)
+	inst.logger.Printf("connfilter resolved key %v (acc %v) action %v chat %v rules fired %v",
+		pubkeyB64, r.Account, r.Action, r.Dispatch.AllowChat, r.firedRules())
+	return r
+}
+
+type joinCheckTraceEntry struct {
+	Rule     string
+	Enabled  bool
+	Fired    bool
+	Action   string         `json:",omitempty"`
+	Mute     bool           `json:",omitempty"`
+	Messages []string       `json:",omitempty"`
+	Inputs   map[string]any `json:",omitempty"`
+}
+
+type joinCheckResult struct {
+	Dispatch joinDispatch
+	Action   joinCheckActionLevel
+	Reason   string
+	Account  *int
+	Trace    []joinCheckTraceEntry
+}
+
+// what rule decided, zero value means rule did not fire
+type joinCheckVerdict struct {
+	fired    bool
+	action   joinCheckActionLevel
+	mute     bool
+	messages []string
+	reason   string
+}
 
-	// was votekicked
-	vtkdur := voteKickCheckRestricted(ip)
-	if vtkdur > 0 {
-		vtkdurS := vtkdur.Round(time.Second).String()
-		if vtkdurS == "0s" {
-			vtkdurS = "1s"
+type joinCheckContext struct {
+	inst      *instance
+	ip        string
+	name      string
+	pubkey    []byte
+	pubkeyB64 string
+	hash      string
+	dryRun    bool
+	lang      string
+	account   *int
+	ban       *joinCheckBan
+	action    joinCheckActionLevel
+	inputs    map[string]any
+	ispLooked bool
+	ispRsp    *ispcheck.LookupResponse
+	ispErr    error
+}
+
+// rules see current action to avoid piling up messages once player already spectates
+type joinCheckRule func(c *joinCheckContext) joinCheckVerdict
+
+func (c *joinCheckContext) msg(key string, args ...string) string {
+	return msgT(c.inst, c.lang, key, args...)
+}
+
+// looked up once per join, rules share the result
+func (c *joinCheckContext) isp() (*ispcheck.LookupResponse, error) {
+	if !c.ispLooked {
+		c.ispLooked = true
+		c.ispRsp, c.ispErr = ISPchecker.Lookup(c.ip)
+		if c.ispErr != nil {
+			c.inst.logger.Printf("Failed to lookup ISP: %s", c.ispErr.Error())
 		}
-		return jd, joinCheckActionLevelReject, "You got votekicked. You will be able to join back in " + vtkdurS + ". If you feel like it is being abused, contact administrators."
 	}
+	return c.ispRsp, c.ispErr
+}
 
-	// ban check
-	var (
-		account          *int
-		banid            *int
-		banissued        *time.Time
-		banexpires       *time.Time
-		banexpired       *bool
-		banreason        *string
-		forbids_joining  *bool
-		forbids_playing  *bool
-		forbids_chatting *bool
-	)
-	err := dbpool.QueryRow(context.Background(), `select 
-	identities.account, bans.id, time_issued, time_expires, coalesce(time_expires < now(), 'false'), reason, forbids_joining, forbids_playing, forbids_chatting
-from identities
-left outer join bans on bans.identity = identities.id or bans.account = identities.account
-where
-	identities.hash = encode(sha256($1), 'hex')
-order by time_expires desc
-limit 1`, pubkey).Scan(&account, &banid, &banissued, &banexpires, &banexpired, &banreason, &forbids_joining, &forbids_playing, &forbids_chatting)
+func (c *joinCheckContext) input(k string, v any) {
+	c.inputs[k] = v
+}
+
+// event log and moderation notifications are skipped in dry run
+func (c *joinCheckContext) logAction(f string, args ...any) string {
+	if c.dryRun {
+		return "A-DRYRUN"
+	}
+	ecode, err := DbLogAction(f, args...)
 	if err != nil {
-		if !errors.Is(err, pgx.ErrNoRows) {
-			inst.logger.Printf("Failed to request bans from database: %s", err.Error())
-		}
+		c.inst.logger.Printf("Failed to log action in database: %s", err.Error())
 	}
-	if banid != nil {
-		if banexpired != nil && !*banexpired {
-			if *forbids_joining {
-				banexpiresstr := "never"
-				if banexpires != nil {
-					banexpiresstr = (*banexpires).String()
-				}
-				return jd, joinCheckActionLevelReject, "You were banned from joining Autohoster.\\n" +
-					"Ban reason: " + *banreason + "\\n\\n" + rejectContactMsg +
-					"Ban issued: " + (*banissued).String() + "\\n" +
-					"Ban expires: " + banexpiresstr + "\\n" +
-					"Event ID: M-" + strconv.Itoa(*banid)
-			}
-			if *forbids_chatting {
-				jd.Messages = append(jd.Messages, "⚠ You are banned from chatting in this room (ban ID: M-"+strconv.Itoa(*banid)+")")
-				jd.AllowChat = false
-			}
-			if *forbids_playing {
-				jd.Messages = append(jd.Messages, "⚠ You are banned from participating in this game (ban ID: M-"+strconv.Itoa(*banid)+")")
-				action = joinCheckActionLevelApproveSpec
-			}
-		}
+	return ecode
+}
+
+func (c *joinCheckContext) notify(kind, ecode, details string) {
+	if c.dryRun {
+		return
 	}
+	moderationNotify(c.inst, kind, c.name, c.hash, c.ip, ecode, details)
+}
 
-	// isp check
-	if account == nil && !tryCfgGetD(tryGetBoolGen("allowNonLinkedHide"), false, inst.cfgs...) {
-		rsp, err := ISPchecker.Lookup(ip)
-		if err != nil {
-			inst.logger.Printf("Failed to lookup ISP: %s", err.Error())
-		} else {
-			isAsnBanned := checkASNbanned(rsp.ASN, inst.cfgs)
-			if rsp.IsProxy || isAsnBanned {
-				ecode, err := DbLogAction("%d [antiproxy] join attempt from %q did not pass isp checks: proxy %v asnban %v (ip was %v)", inst.Id, name, rsp.IsProxy, isAsnBanned, ip)
-				if err != nil {
-					inst.logger.Printf("Failed to log action in database: %s", err.Error())
-				}
-				return jd, joinCheckActionLevelReject, "You were rejected from joining Autohoster.\\n" +
-					"Reason: 2.1.1. Disruption or other interference with the system with or without defined purpose.\\n\\n" +
-					"If you believe it is a mistake, feel free to contact us: https://wz2100-autohost.net/about#contact\\n\\n" +
-					"Please provide event ID: " + ecode + " with your request."
-			}
-		}
+func joinCheckRuleOrder(inst *instance) []string {
+	return tryCfgGetD(tryGetSliceStringGen("joinRules", "order"), joinCheckDefaultRuleOrder, inst.cfgs...)
+}
+
+// rules are configured with "joinRules.<rule>" keys: "enabled", "action"
+// (approve, approvespec, reject or ban), "mute" and "message" override what
+// rule decided once it fired
+func joinCheckEvaluate(inst *instance, ip string, name string, pubkey []byte, pubkeyB64 string, dryRun bool) joinCheckResult {
+	c := &joinCheckContext{
+		inst:      inst,
+		ip:        ip,
+		name:      name,
+		pubkey:    pubkey,
+		pubkeyB64: pubkeyB64,
+		hash:      pubkeyHash(pubkey),
+		dryRun:    dryRun,
+		action:    joinCheckActionLevelApprove,
+	}
+	c.account, c.ban = joinCheckLoadIdentity(inst, pubkey)
+	c.lang = msgAccountLang(inst, c.account)
+	r := joinCheckResult{
+		Dispatch: joinDispatch{
+			Issued:    time.Now(),
+			Messages:  []string{},
+			AllowChat: true,
+			Lang:      c.lang,
+		},
+		Account: c.account,
+		Trace:   []joinCheckTraceEntry{},
 	}
+	return joinCheckRunRules(c, r)
+}
 
-	// check room prefs
-	allowNonLinkedJoin := tryCfgGetD(tryGetBoolGen("allowNonLinkedJoin"), true, inst.cfgs...)
-	if !allowNonLinkedJoin {
-		if account == nil {
-			return jd, joinCheckActionLevelReject, "You can not join this game.\\n\\n" +
-				"You must join with linked player identity. Link one at:\\n" +
-				"https://wz2100-autohost.net/wzlink\\n\\n" +
-				"Do not bother admins/moderators about this."
+// runs rules in configured order until one rejects, stricter action wins
+func joinCheckRunRules(c *joinCheckContext, r joinCheckResult) joinCheckResult {
+	inst := c.inst
+	for _, ruleName := range joinCheckRuleOrder(inst) {
+		rule, ok := joinCheckRules[ruleName]
+		if !ok {
+			inst.logger.Printf("connfilter unknown rule %q", ruleName)
+			continue
 		}
-	}
-	allowNonLinkedPlay := tryCfgGetD(tryGetBoolGen("allowNonLinkedPlay"), true, inst.cfgs...)
-	if !allowNonLinkedPlay {
-		if account == nil {
-			jd.Messages = append(jd.Messages, "⚠ You are not allowed to participate in this game due to being not registered")
-			jd.Messages = append(jd.Messages, "⚠ Link your identity at https://wz2100-autohost.net/wzlink")
-			action = joinCheckActionLevelApproveSpec
+		t := joinCheckTraceEntry{
+			Rule:    ruleName,
+			Enabled: tryCfgGetD(tryGetBoolGen("joinRules", ruleName, "enabled"), !slices.Contains(joinCheckOptInRules, ruleName), inst.cfgs...),
 		}
-	}
-	allowNonLinkedChat := tryCfgGetD(tryGetBoolGen("allowNonLinkedChat"), true, inst.cfgs...)
-	if !allowNonLinkedChat {
-		if account == nil {
-			jd.Messages = append(jd.Messages, "⚠ You are not allowed to chat in this room due to being not registered")
-			jd.Messages = append(jd.Messages, "⚠ Link your identity on https://wz2100-autohost.net/wzlink")
-			jd.AllowChat = false
+		if !t.Enabled {
+			r.Trace = append(r.Trace, t)
+			continue
 		}
-	}
-
-	// rate limit checks
-	asThrCnt := tryCfgGetD(tryGetIntGen("antiSpamThresholdCount"), 3, inst.cfgs...)
-	asThrDur := tryCfgGetD(tryGetIntGen("antiSpamThresholdDuration"), 3*24, inst.cfgs...)
-	if asThrCnt > 0 {
-		rateLimitCounter := 0
-		dbpool.QueryRow(context.Background(), `select
-	count(g.id)
-from games as g
-join players as p on p.game = g.id
-join identities as i on p.identity = i.id
-left join accounts as a on i.account = a.id
-where g.game_time < 60000 and g.time_started + $1::interval > now() and (i.pkey = $2 or a.id = coalesce($3, -1))`, fmt.Sprintf("%d hours", asThrDur), pubkey, account).Scan(&rateLimitCounter)
-		if rateLimitCounter >= asThrCnt {
-			if action == joinCheckActionLevelApprove {
-				jd.Messages = append(jd.Messages, "⚠ You were automatically rate limited for leaving the game early. Do not contact admins/moderators about this, they will not help you")
-				action = joinCheckActionLevelApproveSpec
-				_, err := DbLogAction("%d [antigamespam] Join %q rejected for game spam pkey %s", inst.Id, name, pubkeyB64)
-				if err != nil {
-					inst.logger.Printf("Failed to log action in database: %s", err.Error())
-				}
-			}
+		c.inputs = map[string]any{}
+		v := rule(c)
+		t.Inputs = c.inputs
+		if v.fired {
+			v = joinCheckApplyOverrides(inst, ruleName, v)
+			t.Fired = true
+			t.Action = v.action.Name()
+			t.Mute = v.mute
+			t.Messages = v.messages
 		}
-	}
-
-	// moved out check
-	if joincheckWasMovedOutGlobal.present(pubkeyB64, inst.Id) {
-		if action == joinCheckActionLevelApprove {
-			jd.Messages = append(jd.Messages, "⚠ You are not allowed to participate in the game because moderator moved you out earlier")
-			action = joinCheckActionLevelApproveSpec
-			_, err := DbLogAction("%d [movedout] Join %q forcespec because moved out pkey %s", inst.Id, name, pubkeyB64)
-			if err != nil {
-				inst.logger.Printf("Failed to log action in database: %s", err.Error())
-			}
+		r.Trace = append(r.Trace, t)
+		if !v.fired {
+			continue
 		}
-	}
-
-	// ip based mute
-	if account == nil {
-		if checkIPMatchesConfigs(inst, ip, "ipmute") {
-			jd.AllowChat = false
-			jd.Messages = append(jd.Messages, "⚠ You are not allowed to use free chat because you are not linked to an account. Link today at https://wz2100-autohost.net/")
-			_, err := DbLogAction("%d [ipmute] Join %q muted because no account pkey %s", inst.Id, name, pubkeyB64)
-			if err != nil {
-				inst.logger.Printf("Failed to log action in database: %s", err.Error())
-			}
+		if v.action >= joinCheckActionLevelReject {
+			r.Action = v.action
+			r.Reason = v.reason
+			return r
+		}
+		if v.action > c.action {
+			c.action = v.action
 		}
+		if v.mute {
+			r.Dispatch.AllowChat = false
+		}
+		r.Dispatch.Messages = append(r.Dispatch.Messages, v.messages...)
 	}
+	r.Action = c.action
+	return r
+}
 
-	// ip based playfilter
-	if account == nil {
-		if checkIPMatchesConfigs(inst, ip, "ipnoplay") {
-			if action == joinCheckActionLevelApprove {
-				action = joinCheckActionLevelApproveSpec
-				jd.Messages = append(jd.Messages, "⚠ You are not allowed to participate because you are not linked to an account. Link today at https://wz2100-autohost.net/")
-				_, err := DbLogAction("%d [ipnoplay] Join %q forcespec because no account pkey %s", inst.Id, name, pubkeyB64)
-				if err != nil {
-					inst.logger.Printf("Failed to log action in database: %s", err.Error())
-				}
-			}
+func joinCheckApplyOverrides(inst *instance, ruleName string, v joinCheckVerdict) joinCheckVerdict {
+	if a := tryCfgGet(tryGetStringGen("joinRules", ruleName, "action"), inst.cfgs...); a != nil {
+		l, ok := parseJoinCheckActionLevel(*a)
+		if ok {
+			v.action = l
+		} else {
+			inst.logger.Printf("connfilter rule %q has invalid action override %q", ruleName, *a)
 		}
 	}
-
-	// terminated account
-	var terminated bool
-	dbpool.QueryRow(context.Background(), `select terminated
-from accounts as a
-join identities as i on i.account = a.id
-where i.pkey = $1`, pubkey).Scan(&terminated)
-	if terminated {
-		if action == joinCheckActionLevelApprove {
-			ecode, err := DbLogAction("%d [terminated] Join %q rejected because account terminated pkey %s", inst.Id, name, pubkeyB64)
-			if err != nil {
-				inst.logger.Printf("Failed to log action in database: %s", err.Error())
-			}
-			return jd, joinCheckActionLevelReject, "You were rejected from joining Autohoster.\\n" +
-				"Your identity is linked to terminated account. Joining with terminated account is not allowed.\\n\\n" +
-				"If you believe it is a mistake, feel free to contact us: https://wz2100-autohost.net/about#contact\\n\\n" +
-				"Please provide event ID: " + ecode + " with your request."
+	if m := tryCfgGet(tryGetBoolGen("joinRules", ruleName, "mute"), inst.cfgs...); m != nil {
+		v.mute = *m
+	}
+	if m := tryCfgGet(tryGetStringGen("joinRules", ruleName, "message"), inst.cfgs...); m != nil {
+		if v.action >= joinCheckActionLevelReject {
+			v.reason = *m
+		} else {
+			v.messages = []string{*m}
 		}
 	}
+	return v
+}
 
-	defaultNames := []string{"_", "Player", "플레이어", "Giocatore", "Gracz", "Hráč", "Igrač", "Igralec", "Imreoir", "Játékos", "Jogador", "Joueur", "Jucător", "Jugador", "Mägija", "Oyuncu", "Pelaaja", "Pemain", "Speler", "Spieler", "Spiler", "Spiller", "Žaidėjas", "Παίκτης", "Гравець", "Играч", "Игрок", "Уенчы", "اللاعب", "玩家"}
-	for _, v := range defaultNames {
-		if name == v {
-			jd.Messages = append(jd.Messages, "⚠ You are not allowed to participate in the game because you are using default name, please change it in top left field and rejoin.")
-			action = joinCheckActionLevelApproveSpec
-			_, err := DbLogAction("%d [defaultname] Join %q forcespec because default name pkey %s", inst.Id, name, pubkeyB64)
-			if err != nil {
-				inst.logger.Printf("Failed to log action in database: %s", err.Error())
+var errJoinCheckQueueNotFound = errors.New("queue not found")
+
+// dry run against running instance or queue config as if lobby of that queue
+// was hosted right now, nothing is logged or reported to moderators
+func joinCheckExplain(instanceID int64, queueName string, ip string, name string, pubkeyB64 string) (*joinCheckResult, error) {
+	pubkey, err := base64.StdEncoding.DecodeString(pubkeyB64)
+	if err != nil {
+		return nil, err
+	}
+	var inst *instance
+	if instanceID != 0 {
+		instancesLock.Lock()
+		for _, v := range instances {
+			if v.Id == instanceID {
+				inst = v
 			}
 		}
-	}
-
-	// keep spammers muted but with account allow rejoin to unmute
-	if account == nil {
-		if chatSpamIsMuted(inst, ip) {
-			jd.AllowChat = false
-			jd.Messages = append(jd.Messages, "⚠ You are temporarily not allowed to use free chat because you spammed in chat.")
+		instancesLock.Unlock()
+		if inst == nil {
+			return nil, errInstanceNotFound
+		}
+	} else {
+		if _, ok := cfg.GetKeys("queues", queueName); !ok {
+			return nil, errJoinCheckQueueNotFound
+		}
+		c := cfg.DupSubTree("queues", queueName)
+		inst = &instance{
+			Id:        -1,
+			QueueName: queueName,
+			cfg:       c,
+			cfgs: []lac.Conf{
+				c,
+				cfg.LinkSubTree("settingsFallback"),
+			},
+			logger: log.New(log.Writer(), "explain ", log.Flags()|log.Lmsgprefix),
 		}
 	}
-
-	inst.logger.Printf("connfilter resolved key %v nljoin %v (acc %v) nlplay %v (action %v) nlchat %v (allowed %v)",
-		pubkeyB64,
-		allowNonLinkedJoin, account,
-		allowNonLinkedPlay, action,
-		allowNonLinkedChat, jd.AllowChat,
-	)
-
-	return jd, action, ""
+	r := joinCheckEvaluate(inst, ip, name, pubkey, pubkeyB64, true)
+	return &r, nil
 }
 
 func checkIPMatchesConfigs(inst *instance, ip string, confpath ...string) bool {
@@ -317,6 +314,30 @@ const (
 	joinCheckActionLevelBan
 )
 
+func (l joinCheckActionLevel) Name() string {
+	switch l {
+	case joinCheckActionLevelApprove:
+		return "approve"
+	case joinCheckActionLevelApproveSpec:
+		return "approvespec"
+	case joinCheckActionLevelReject:
+		return "reject"
+	case joinCheckActionLevelBan:
+		return "ban"
+	default:
+		return "unknown"
+	}
+}
+
+func parseJoinCheckActionLevel(s string) (joinCheckActionLevel, bool) {
+	for _, l := range []joinCheckActionLevel{joinCheckActionLevelApprove, joinCheckActionLevelApproveSpec, joinCheckActionLevelReject, joinCheckActionLevelBan} {
+		if l.Name() == s {
+			return l, true
+		}
+	}
+	return joinCheckActionLevelApprove, false
+}
+
 func (l joinCheckActionLevel) String() string {
 	switch l {
 	case joinCheckActionLevelApprove:
@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"embed"
+	"io/fs"
 	"log"
 
 	"github.com/jackc/pgx/v4/pgxpool"
@@ -11,6 +13,11 @@ var (
 	dbpool *pgxpool.Pool
 )
 
+// tables owned by backend, every file must be safe to apply repeatedly
+//
+//go:embed schema/*.sql
+var dbSchema embed.FS
+
 func connectToDatabase() {
 	connstr, ok := cfg.GetString("databaseConnString")
 	if !ok {
@@ -22,3 +29,24 @@ func connectToDatabase() {
 		log.Fatalf("Failed to connect to database: %s", err.Error())
 	}
 }
+
+func applyDatabaseSchema() {
+	if !cfg.GetDBool(true, "databaseApplySchema") {
+		return
+	}
+	files, err := fs.Glob(dbSchema, "schema/*.sql")
+	if err != nil {
+		log.Fatalf("Failed to list database schema: %s", err.Error())
+	}
+	for _, f := range files {
+		b, err := dbSchema.ReadFile(f)
+		if err != nil {
+			log.Fatalf("Failed to read database schema %s: %s", f, err.Error())
+		}
+		_, err = dbpool.Exec(context.Background(), string(b))
+		if err != nil {
+			log.Printf("Failed to apply database schema %s: %s", f, err.Error())
+			discordPostError("Failed to apply database schema %s: %s", f, err.Error())
+		}
+	}
+}
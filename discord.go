@@ -3,7 +3,6 @@ package main
 import (
 	"bytes"
 	"encoding/json"
-	"fmt"
 	"io"
 	"log"
 	"mime/multipart"
@@ -11,48 +10,15 @@ import (
 	"time"
 )
 
-var (
-	discordPostErrors = make(chan string, 128)
-)
-
-func routineDiscordErrorReporter() {
-	// lastMessage := time.Now()
-	lastAggregate := ""
-	dflusher := time.NewTicker(time.Second * 60)
-	for {
-		select {
-		case msg := <-discordPostErrors:
-			lastAggregate += msg + "\n"
-			// if time.Since(lastMessage).Seconds() > 2.5*float64(time.Second) {
-			// 	discordSendError(lastAggregate)
-			// 	lastAggregate = ""
-			// 	lastMessage = time.Now()
-			// }
-		case <-dflusher.C:
-			if lastAggregate == "" {
-				continue
-			}
-			webhookUrl, ok := cfg.GetString("discordErrorsWebhook")
-			if !ok {
-				log.Println("Errors discord webhook not set!!!")
-				return
-			}
-			if len(lastAggregate) < 1995 {
-				discordSendErrorWithContent(webhookUrl, lastAggregate)
-			} else {
-				discordSendErrorWithFile(webhookUrl, lastAggregate)
-			}
-			lastAggregate = ""
-			// lastMessage = time.Now()
-		}
-	}
-}
-
 func discordSendErrorWithContent(webhookUrl, content string) {
-	payload_json, err := json.Marshal(map[string]interface{}{
+	discordSendWebhookJSON(webhookUrl, map[string]any{
 		"username": "Backend",
 		"content":  content,
 	})
+}
+
+func discordSendWebhookJSON(webhookUrl string, payload map[string]any) {
+	payload_json, err := json.Marshal(payload)
 	if err != nil {
 		log.Println("Error marshling webhook json payload:", err)
 		return
@@ -134,7 +100,3 @@ func discordSendErrorWithFile(webhookUrl, content string) {
 		log.Println("Discord returned not 200: ", res.StatusCode, string(rspb))
 	}
 }
-
-func discordPostError(format string, args ...any) {
-	discordPostErrors <- fmt.Sprintf(format, args...)
-}
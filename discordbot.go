@@ -0,0 +1,423 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Discord bot works over plain REST and HTTP interactions endpoint, no gateway
+// connection is held. apiBase can be pointed to a local fake to test things.
+
+var (
+	discordBotStatusLock     sync.Mutex
+	discordBotStatusMessages = map[string]string{}
+	discordBotStatusContents = map[string]string{}
+
+	errDiscordBotNotFound = errors.New("not found")
+)
+
+func discordBotEnabled() bool {
+	return cfg.GetDBool(false, "discordBot", "enabled")
+}
+
+func discordBotAPI(method, apipath string, payload any) ([]byte, error) {
+	var body io.Reader
+	if payload != nil {
+		b, err := json.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, cfg.GetDString("https://discord.com/api/v10", "discordBot", "apiBase")+apipath, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bot "+cfg.GetDString("", "discordBot", "token"))
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	c := http.Client{Timeout: 5 * time.Second}
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	rspb, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, errDiscordBotNotFound
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("discord returned %d: %s", resp.StatusCode, string(rspb))
+	}
+	return rspb, nil
+}
+
+func routineDiscordBot(closechan <-chan struct{}) {
+	if !discordBotEnabled() {
+		log.Println("Discord bot disabled")
+		return
+	}
+	discordBotLoadState()
+	err := discordBotRegisterCommands()
+	if err != nil {
+		log.Printf("Discord bot failed to register commands: %s", err.Error())
+		discordPostError("Discord bot failed to register commands: %s", err.Error())
+	}
+	for {
+		discordBotUpdateStatuses()
+		select {
+		case <-closechan:
+			return
+		case <-time.After(time.Duration(cfg.GetDInt(15, "discordBot", "statusIntervalSeconds")) * time.Second):
+		}
+	}
+}
+
+func discordBotStatePath() string {
+	return cfg.GetDString("discordbot.json", "discordBot", "stateFile")
+}
+
+func discordBotLoadState() {
+	b, err := os.ReadFile(discordBotStatePath())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Discord bot failed to read state: %s", err.Error())
+		}
+		return
+	}
+	discordBotStatusLock.Lock()
+	defer discordBotStatusLock.Unlock()
+	err = json.Unmarshal(b, &discordBotStatusMessages)
+	if err != nil {
+		log.Printf("Discord bot failed to parse state: %s", err.Error())
+	}
+}
+
+func discordBotSaveStateNOLOCK() {
+	b, err := json.Marshal(discordBotStatusMessages)
+	if err != nil {
+		log.Printf("Discord bot failed to marshal state: %s", err.Error())
+		return
+	}
+	err = os.WriteFile(discordBotStatePath(), b, 0644)
+	if err != nil {
+		log.Printf("Discord bot failed to save state: %s", err.Error())
+	}
+}
+
+func discordBotUpdateStatuses() {
+	channel, ok := cfg.GetString("discordBot", "statusChannel")
+	if !ok {
+		return
+	}
+	queuesK, ok := cfg.GetKeys("queues")
+	if !ok {
+		return
+	}
+	sort.Strings(queuesK)
+	discordBotStatusLock.Lock()
+	defer discordBotStatusLock.Unlock()
+	for _, queueName := range queuesK {
+		status := discordBotQueueStatus(queueName)
+		if discordBotStatusContents[queueName] == status {
+			continue
+		}
+		content := status + fmt.Sprintf("\n-# Updated <t:%d:R>", time.Now().Unix())
+		msgid, ok := discordBotStatusMessages[queueName]
+		if ok {
+			_, err := discordBotAPI("PATCH", fmt.Sprintf("/channels/%s/messages/%s", channel, msgid), map[string]any{"content": content})
+			if err == nil {
+				discordBotStatusContents[queueName] = status
+				continue
+			}
+			if !errors.Is(err, errDiscordBotNotFound) {
+				log.Printf("Discord bot failed to edit status of queue %q: %s", queueName, err.Error())
+				continue
+			}
+		}
+		rsp, err := discordBotAPI("POST", fmt.Sprintf("/channels/%s/messages", channel), map[string]any{"content": content})
+		if err != nil {
+			log.Printf("Discord bot failed to post status of queue %q: %s", queueName, err.Error())
+			continue
+		}
+		var msg struct {
+			ID string `json:"id"`
+		}
+		err = json.Unmarshal(rsp, &msg)
+		if err != nil {
+			log.Printf("Discord bot failed to parse posted message: %s", err.Error())
+			continue
+		}
+		discordBotStatusMessages[queueName] = msg.ID
+		discordBotStatusContents[queueName] = status
+		discordBotSaveStateNOLOCK()
+	}
+}
+
+func discordBotQueueStatus(queueName string) string {
+	ret := fmt.Sprintf("**%s**", queueName)
+	if isQueueDisabled(queueName) {
+		return ret + " (disabled)"
+	}
+	lobbyLines := []string{}
+	runningLines := []string{}
+	instancesLock.Lock()
+	for _, inst := range instances {
+		if inst.QueueName != queueName {
+			continue
+		}
+		st := instanceState(inst.state.Load())
+		switch {
+		case st <= instanceStateInLobby:
+			rs := inst.RoomStatus.DupSubTree()
+			slots := []string{}
+			occupied := 0
+			for slot := range inst.Settings.PlayerCount {
+				if roomStatusPlayerSlotToPropertyString(rs, slot, "type") == "player" {
+					occupied++
+					slots = append(slots, "`"+strings.ReplaceAll(roomStatusPlayerSlotToPropertyString(rs, slot, "name"), "`", "")+"`")
+				} else {
+					slots = append(slots, "_open_")
+				}
+			}
+			lobbyLines = append(lobbyLines, fmt.Sprintf("🟢 `%s` map `%s`, time limit %d min, players %d/%d: %s",
+				instanceJoinAddress(inst), inst.Settings.MapName, inst.Settings.TimeLimit, occupied, inst.Settings.PlayerCount, strings.Join(slots, ", ")))
+		case st == instanceStateInGame:
+			runningLines = append(runningLines, fmt.Sprintf("⚔ map `%s` running for %s", inst.Settings.MapName, time.Since(time.Unix(inst.Id, 0)).Round(time.Minute)))
+		}
+	}
+	instancesLock.Unlock()
+	if len(lobbyLines) == 0 {
+		lobbyLines = append(lobbyLines, "No room in lobby right now")
+	}
+	ret += "\n" + strings.Join(lobbyLines, "\n")
+	if len(runningLines) > 0 {
+		ret += fmt.Sprintf("\nRunning games: %d\n", len(runningLines)) + strings.Join(runningLines, "\n")
+	}
+	return ret
+}
+
+func discordBotRegisterCommands() error {
+	appid, ok := cfg.GetString("discordBot", "applicationID")
+	if !ok {
+		return nil
+	}
+	apipath := fmt.Sprintf("/applications/%s/commands", appid)
+	guild, ok := cfg.GetString("discordBot", "guildID")
+	if ok {
+		apipath = fmt.Sprintf("/applications/%s/guilds/%s/commands", appid, guild)
+	}
+	_, err := discordBotAPI("PUT", apipath, []map[string]any{{
+		"name":        "request",
+		"description": "Request a room from queue preset",
+		"options": []map[string]any{{
+			"type":        3,
+			"name":        "queue",
+			"description": "Queue name",
+			"required":    true,
+		}},
+	}, {
+		"name":        "shutdown",
+		"description": "Shut down instance",
+		"options": []map[string]any{{
+			"type":        4,
+			"name":        "instance",
+			"description": "Instance ID",
+			"required":    true,
+		}},
+	}, {
+		"name":        "broadcast",
+		"description": "Broadcast message to rooms",
+		"options": []map[string]any{{
+			"type":        3,
+			"name":        "message",
+			"description": "Message text",
+			"required":    true,
+		}, {
+			"type":        4,
+			"name":        "instance",
+			"description": "Instance ID (all rooms if not set)",
+			"required":    false,
+		}},
+	}})
+	return err
+}
+
+type discordInteraction struct {
+	Type          int    `json:"type"`
+	ApplicationID string `json:"application_id"`
+	Token         string `json:"token"`
+	Member        struct {
+		Roles []string `json:"roles"`
+		User  struct {
+			ID       string `json:"id"`
+			Username string `json:"username"`
+		} `json:"user"`
+	} `json:"member"`
+	Data struct {
+		Name    string `json:"name"`
+		Options []struct {
+			Name  string          `json:"name"`
+			Value json.RawMessage `json:"value"`
+		} `json:"options"`
+	} `json:"data"`
+}
+
+func (i *discordInteraction) optionString(name string) (string, bool) {
+	for _, o := range i.Data.Options {
+		if o.Name == name {
+			var ret string
+			if json.Unmarshal(o.Value, &ret) == nil {
+				return ret, true
+			}
+		}
+	}
+	return "", false
+}
+
+func (i *discordInteraction) optionInt(name string) (int64, bool) {
+	for _, o := range i.Data.Options {
+		if o.Name == name {
+			var ret int64
+			if json.Unmarshal(o.Value, &ret) == nil {
+				return ret, true
+			}
+		}
+	}
+	return 0, false
+}
+
+func discordBotVerifySignature(r *http.Request, body []byte) bool {
+	pubkey, err := hex.DecodeString(cfg.GetDString("", "discordBot", "publicKey"))
+	if err != nil || len(pubkey) != ed25519.PublicKeySize {
+		log.Println("Discord bot public key is not set or invalid")
+		return false
+	}
+	sig, err := hex.DecodeString(r.Header.Get("X-Signature-Ed25519"))
+	if err != nil {
+		return false
+	}
+	msg := append([]byte(r.Header.Get("X-Signature-Timestamp")), body...)
+	return ed25519.Verify(pubkey, msg, sig)
+}
+
+func webHandleDiscordInteractions(w http.ResponseWriter, r *http.Request) {
+	if !discordBotEnabled() {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	b, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if !discordBotVerifySignature(r, b) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	var in discordInteraction
+	err = json.Unmarshal(b, &in)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var rsp map[string]any
+	switch in.Type {
+	case 1: // PING
+		rsp = map[string]any{"type": 1}
+	case 2: // APPLICATION_COMMAND
+		rsp = discordBotHandleCommand(&in)
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	rspb, err := json.Marshal(rsp)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(rspb)
+}
+
+func discordBotReply(content string) map[string]any {
+	return map[string]any{
+		"type": 4,
+		"data": map[string]any{
+			"content": content,
+			"flags":   64,
+		},
+	}
+}
+
+func discordBotHandleCommand(in *discordInteraction) map[string]any {
+	modRoles := cfg.GetDSliceString([]string{}, "discordBot", "moderatorRoles")
+	if !slices.ContainsFunc(in.Member.Roles, func(r string) bool { return slices.Contains(modRoles, r) }) {
+		return discordBotReply("⚠ You are not allowed to use this command")
+	}
+	log.Printf("Discord bot command %q from %s (%s)", in.Data.Name, in.Member.User.Username, in.Member.User.ID)
+	switch in.Data.Name {
+	case "request":
+		queueName, _ := in.optionString("queue")
+		// empty name would spawn from the whole queues subtree
+		if _, ok := cfg.GetKeys("queues", queueName); queueName == "" || !ok {
+			return discordBotReply(fmt.Sprintf("⚠ Queue %q not found", queueName))
+		}
+		// generating instance can take longer than discord waits for response
+		go func() {
+			content := ""
+			gi, err := spawnRequestedInstance(cfg.DupSubTree("queues", queueName))
+			if err != nil {
+				log.Printf("Discord room request: failed to generate instance: %s", err.Error())
+				discordPostError("Discord room request: failed to generate instance: %s", err.Error())
+				content = "⚠ Failed to create room: " + err.Error()
+			} else {
+				content = fmt.Sprintf("Room created (instance %d), join with %s", gi.Id, instanceJoinAddress(gi))
+			}
+			_, err = discordBotAPI("PATCH", fmt.Sprintf("/webhooks/%s/%s/messages/@original", in.ApplicationID, in.Token), map[string]any{"content": content})
+			if err != nil {
+				log.Printf("Discord bot failed to edit interaction response: %s", err.Error())
+			}
+		}()
+		return map[string]any{
+			"type": 5,
+			"data": map[string]any{"flags": 64},
+		}
+	case "shutdown":
+		instanceID, _ := in.optionInt("instance")
+		if !sendInstanceCommand(instanceID, instanceCommand{command: icShutdown}) {
+			return discordBotReply(fmt.Sprintf("⚠ Failed to send shutdown to instance %d", instanceID))
+		}
+		return discordBotReply(fmt.Sprintf("Shutdown sent to instance %d", instanceID))
+	case "broadcast":
+		msg, _ := in.optionString("message")
+		cmd := instanceCommand{command: icBroadcast, data: msg}
+		instanceID, ok := in.optionInt("instance")
+		if ok {
+			if !sendInstanceCommand(instanceID, cmd) {
+				return discordBotReply(fmt.Sprintf("⚠ Failed to send broadcast to instance %d", instanceID))
+			}
+			return discordBotReply(fmt.Sprintf("Broadcast sent to instance %d", instanceID))
+		}
+		return discordBotReply(fmt.Sprintf("Broadcast sent to %d instances", broadcastInstanceCommand(cmd)))
+	}
+	return discordBotReply(fmt.Sprintf("⚠ Unknown command %q", in.Data.Name))
+}
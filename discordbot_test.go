@@ -0,0 +1,214 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/maxsupermanhd/lac/v2"
+)
+
+type fakeDiscordRequest struct {
+	method string
+	path   string
+	auth   string
+	body   map[string]any
+}
+
+// records REST calls and answers them like discord would
+type fakeDiscord struct {
+	lock     sync.Mutex
+	requests []fakeDiscordRequest
+	messages map[string]bool
+	lastID   int
+}
+
+func (f *fakeDiscord) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	b, _ := io.ReadAll(r.Body)
+	req := fakeDiscordRequest{method: r.Method, path: r.URL.Path, auth: r.Header.Get("Authorization")}
+	json.Unmarshal(b, &req.body)
+	f.requests = append(f.requests, req)
+	switch {
+	case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/messages"):
+		f.lastID++
+		id := strconv.Itoa(f.lastID)
+		f.messages[id] = true
+		json.NewEncoder(w).Encode(map[string]any{"id": id})
+	case r.Method == http.MethodPatch && strings.HasPrefix(r.URL.Path, "/channels/"):
+		if !f.messages[r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]] {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte("{}"))
+	case r.Method == http.MethodPut:
+		w.Write([]byte("[]"))
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func (f *fakeDiscord) take() []fakeDiscordRequest {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	ret := f.requests
+	f.requests = nil
+	return ret
+}
+
+func setupFakeDiscord(t *testing.T) *fakeDiscord {
+	f := &fakeDiscord{messages: map[string]bool{}}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	cfg = lac.NewConf()
+	cfg.Set(true, "discordBot", "enabled")
+	cfg.Set(srv.URL, "discordBot", "apiBase")
+	cfg.Set("bottoken", "discordBot", "token")
+	cfg.Set("100", "discordBot", "statusChannel")
+	cfg.Set(filepath.Join(t.TempDir(), "discordbot.json"), "discordBot", "stateFile")
+	cfg.Set(true, "queues", "ranked", "disabled")
+	discordBotStatusLock.Lock()
+	discordBotStatusMessages = map[string]string{}
+	discordBotStatusContents = map[string]string{}
+	discordBotStatusLock.Unlock()
+	return f
+}
+
+func TestDiscordBotUpdateStatuses(t *testing.T) {
+	f := setupFakeDiscord(t)
+
+	discordBotUpdateStatuses()
+	reqs := f.take()
+	if len(reqs) != 1 || reqs[0].method != http.MethodPost || reqs[0].path != "/channels/100/messages" {
+		t.Fatalf("expected status to be posted, got %+v", reqs)
+	}
+	if reqs[0].auth != "Bot bottoken" {
+		t.Errorf("wrong authorization header %q", reqs[0].auth)
+	}
+	if content, _ := reqs[0].body["content"].(string); !strings.HasPrefix(content, "**ranked** (disabled)") {
+		t.Errorf("unexpected status content %q", content)
+	}
+	if discordBotStatusMessages["ranked"] != "1" {
+		t.Errorf("posted message id was not remembered: %v", discordBotStatusMessages)
+	}
+
+	discordBotUpdateStatuses()
+	if reqs := f.take(); len(reqs) != 0 {
+		t.Fatalf("unchanged status was sent again: %+v", reqs)
+	}
+
+	cfg.Set(false, "queues", "ranked", "disabled")
+	discordBotUpdateStatuses()
+	reqs = f.take()
+	if len(reqs) != 1 || reqs[0].method != http.MethodPatch || reqs[0].path != "/channels/100/messages/1" {
+		t.Fatalf("expected status message to be edited, got %+v", reqs)
+	}
+
+	// message deleted in discord, bot posts a new one
+	f.lock.Lock()
+	delete(f.messages, "1")
+	f.lock.Unlock()
+	cfg.Set(true, "queues", "ranked", "disabled")
+	discordBotUpdateStatuses()
+	reqs = f.take()
+	if len(reqs) != 2 || reqs[0].method != http.MethodPatch || reqs[1].method != http.MethodPost {
+		t.Fatalf("expected failed edit followed by new post, got %+v", reqs)
+	}
+	if discordBotStatusMessages["ranked"] != "2" {
+		t.Errorf("new message id was not remembered: %v", discordBotStatusMessages)
+	}
+}
+
+func TestDiscordBotRegisterCommands(t *testing.T) {
+	f := setupFakeDiscord(t)
+	cfg.Set("200", "discordBot", "applicationID")
+	cfg.Set("300", "discordBot", "guildID")
+	err := discordBotRegisterCommands()
+	if err != nil {
+		t.Fatal(err)
+	}
+	reqs := f.take()
+	if len(reqs) != 1 || reqs[0].method != http.MethodPut || reqs[0].path != "/applications/200/guilds/300/commands" {
+		t.Fatalf("expected guild commands to be registered, got %+v", reqs)
+	}
+}
+
+func signedInteraction(t *testing.T, key ed25519.PrivateKey, body string) *http.Request {
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	r := httptest.NewRequest(http.MethodPost, "/discord/interactions", strings.NewReader(body))
+	r.Header.Set("X-Signature-Timestamp", ts)
+	r.Header.Set("X-Signature-Ed25519", hex.EncodeToString(ed25519.Sign(key, []byte(ts+body))))
+	return r
+}
+
+func TestDiscordInteractions(t *testing.T) {
+	setupFakeDiscord(t)
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Set(hex.EncodeToString(pub), "discordBot", "publicKey")
+	cfg.Set([]any{"mods"}, "discordBot", "moderatorRoles")
+
+	w := httptest.NewRecorder()
+	webHandleDiscordInteractions(w, signedInteraction(t, priv, `{"type":1}`))
+	if w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != `{"type":1}` {
+		t.Fatalf("ping: got %d %q", w.Code, w.Body.String())
+	}
+
+	r := signedInteraction(t, priv, `{"type":1}`)
+	r.Header.Set("X-Signature-Timestamp", "0")
+	w = httptest.NewRecorder()
+	webHandleDiscordInteractions(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("bad signature: got %d", w.Code)
+	}
+
+	tests := []struct {
+		name  string
+		body  string
+		reply string
+	}{{
+		name:  "not moderator",
+		body:  `{"type":2,"member":{"roles":["users"]},"data":{"name":"request","options":[{"name":"queue","value":"ranked"}]}}`,
+		reply: "⚠ You are not allowed to use this command",
+	}, {
+		name:  "missing queue",
+		body:  `{"type":2,"member":{"roles":["mods"]},"data":{"name":"request"}}`,
+		reply: `⚠ Queue "" not found`,
+	}, {
+		name:  "unknown queue",
+		body:  `{"type":2,"member":{"roles":["mods"]},"data":{"name":"request","options":[{"name":"queue","value":"casual"}]}}`,
+		reply: `⚠ Queue "casual" not found`,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			webHandleDiscordInteractions(w, signedInteraction(t, priv, tt.body))
+			var rsp struct {
+				Type int `json:"type"`
+				Data struct {
+					Content string `json:"content"`
+				} `json:"data"`
+			}
+			err := json.Unmarshal(w.Body.Bytes(), &rsp)
+			if err != nil {
+				t.Fatalf("got %d %q: %s", w.Code, w.Body.String(), err.Error())
+			}
+			if rsp.Type != 4 || rsp.Data.Content != tt.reply {
+				t.Errorf("got reply %d %q, expected %q", rsp.Type, rsp.Data.Content, tt.reply)
+			}
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"regexp"
+	"slices"
+	"sync"
+	"time"
+)
+
+type errorReportEntry struct {
+	Fingerprint string
+	Message     string
+	Count       int
+	FirstSeen   time.Time
+	LastSeen    time.Time
+	reported    int
+}
+
+type errorReporter struct {
+	lock       sync.Mutex
+	entries    map[string]*errorReportEntry
+	maxEntries int
+}
+
+var (
+	errorReports = errorReporter{
+		entries:    map[string]*errorReportEntry{},
+		maxEntries: 1000,
+	}
+
+	errorFingerprintHexRegex   = regexp.MustCompile(`0x[0-9a-fA-F]+`)
+	errorFingerprintDigitRegex = regexp.MustCompile(`[0-9]+`)
+)
+
+// instance ids, game ids, addresses and such are stripped so the same
+// error coming from different instances ends up in the same entry
+func errorFingerprint(msg string) string {
+	n := errorFingerprintHexRegex.ReplaceAllString(msg, "0x")
+	n = errorFingerprintDigitRegex.ReplaceAllString(n, "#")
+	h := sha256.Sum256([]byte(n))
+	return hex.EncodeToString(h[:8])
+}
+
+func (r *errorReporter) add(msg string) {
+	fp := errorFingerprint(msg)
+	now := time.Now()
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	e, ok := r.entries[fp]
+	if !ok {
+		if len(r.entries) >= r.maxEntries {
+			r.evictOldest()
+		}
+		r.entries[fp] = &errorReportEntry{
+			Fingerprint: fp,
+			Message:     msg,
+			Count:       1,
+			FirstSeen:   now,
+			LastSeen:    now,
+		}
+		return
+	}
+	e.Message = msg
+	e.Count++
+	e.LastSeen = now
+}
+
+// drops least recently seen entry, already reported ones go first
+func (r *errorReporter) evictOldest() {
+	var oldest *errorReportEntry
+	for _, e := range r.entries {
+		if oldest == nil {
+			oldest = e
+			continue
+		}
+		eReported, oldestReported := e.Count == e.reported, oldest.Count == oldest.reported
+		if eReported != oldestReported {
+			if eReported {
+				oldest = e
+			}
+			continue
+		}
+		if e.LastSeen.Before(oldest.LastSeen) {
+			oldest = e
+		}
+	}
+	if oldest != nil {
+		delete(r.entries, oldest.Fingerprint)
+	}
+}
+
+func (r *errorReporter) setMaxEntries(n int) {
+	r.lock.Lock()
+	r.maxEntries = max(n, 1)
+	r.lock.Unlock()
+}
+
+// collects entries that got new occurrences since last flush
+func (r *errorReporter) takeUnreported() []errorReportEntry {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	ret := []errorReportEntry{}
+	for _, e := range r.entries {
+		if e.Count == e.reported {
+			continue
+		}
+		c := *e
+		c.Count = e.Count - e.reported
+		ret = append(ret, c)
+		e.reported = e.Count
+	}
+	slices.SortFunc(ret, func(a, b errorReportEntry) int {
+		return a.FirstSeen.Compare(b.FirstSeen)
+	})
+	return ret
+}
+
+func (r *errorReporter) cleanup(retention time.Duration) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for k, e := range r.entries {
+		if e.Count == e.reported && time.Since(e.LastSeen) > retention {
+			delete(r.entries, k)
+		}
+	}
+}
+
+func (r *errorReporter) snapshot() []errorReportEntry {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	ret := make([]errorReportEntry, 0, len(r.entries))
+	for _, e := range r.entries {
+		ret = append(ret, *e)
+	}
+	slices.SortFunc(ret, func(a, b errorReportEntry) int {
+		return b.LastSeen.Compare(a.LastSeen)
+	})
+	return ret
+}
+
+func routineDiscordErrorReporter() {
+	// ticker panics on non positive interval
+	dflusher := time.NewTicker(time.Second * time.Duration(max(cfg.GetDSInt(60, "errorReportFlushSeconds"), 1)))
+	for range dflusher.C {
+		errorReports.setMaxEntries(cfg.GetDSInt(1000, "errorReportMaxEntries"))
+		errorReports.cleanup(time.Hour * time.Duration(cfg.GetDSInt(24, "errorReportRetentionHours")))
+		pending := errorReports.takeUnreported()
+		if len(pending) == 0 {
+			continue
+		}
+		webhookUrl, ok := cfg.GetString("discordErrorsWebhook")
+		if !ok {
+			log.Println("Errors discord webhook not set!!!")
+			continue
+		}
+		aggregate := ""
+		for _, e := range pending {
+			if e.Count == 1 {
+				aggregate += e.Message + "\n"
+			} else {
+				aggregate += fmt.Sprintf("[x%d, first %s, last %s] %s\n", e.Count,
+					e.FirstSeen.Format(time.TimeOnly), e.LastSeen.Format(time.TimeOnly), e.Message)
+			}
+		}
+		if len(aggregate) < 1995 {
+			discordSendErrorWithContent(webhookUrl, aggregate)
+		} else {
+			discordSendErrorWithFile(webhookUrl, aggregate)
+		}
+	}
+}
+
+func discordPostError(format string, args ...any) {
+	errorReports.add(fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// index is a manual migration (schema/manual/evasion_chatlog_ip_inet.sql),
+// concurrent build can not run in startup schema transaction
+func evasionCheckIndex() {
+	var valid bool
+	err := dbpool.QueryRow(context.Background(), `select i.indisvalid
+from pg_index as i
+join pg_class as c on c.oid = i.indexrelid
+where c.relname = 'chatlog_ip_inet'`).Scan(&valid)
+	if errors.Is(err, pgx.ErrNoRows) {
+		log.Printf("Index chatlog_ip_inet is missing, evasion rule will scan whole chatlog, see schema/manual/evasion_chatlog_ip_inet.sql")
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to check chatlog_ip_inet index: %s", err.Error())
+		return
+	}
+	if !valid {
+		log.Printf("Index chatlog_ip_inet is invalid, drop and rebuild it with schema/manual/evasion_chatlog_ip_inet.sql")
+		discordPostError("Index chatlog_ip_inet is invalid, drop and rebuild it with schema/manual/evasion_chatlog_ip_inet.sql")
+	}
+}
+
+// identity that shared network with currently banned one
+type evasionCandidate struct {
+	ban    joinCheckBan
+	hash   string
+	name   string
+	ip     string
+	sameIP bool
+	score  float64
+	why    []string
+}
+
+func evasionSubnet(inst *instance, ip string) string {
+	clip := net.ParseIP(ip)
+	if clip == nil {
+		return ""
+	}
+	if clip.To4() != nil {
+		bits := tryCfgGetD(tryGetIntGen("evasion", "subnetV4"), 24, inst.cfgs...)
+		return (&net.IPNet{IP: clip.Mask(net.CIDRMask(bits, 32)), Mask: net.CIDRMask(bits, 32)}).String()
+	}
+	bits := tryCfgGetD(tryGetIntGen("evasion", "subnetV6"), 48, inst.cfgs...)
+	return (&net.IPNet{IP: clip.Mask(net.CIDRMask(bits, 128)), Mask: net.CIDRMask(bits, 128)}).String()
+}
+
+func evasionCandidates(ctx context.Context, ip string, subnet string, pubkey []byte) ([]*evasionCandidate, error) {
+	ret := []*evasionCandidate{}
+	var (
+		c        evasionCandidate
+		expires  *time.Time
+		reason   *string
+		fJoining *bool
+		fPlaying *bool
+		fChat    *bool
+	)
+	_, err := dbpool.QueryFunc(ctx, `select distinct on (b.id)
+	b.id, b.time_issued, b.time_expires, b.reason, b.forbids_joining, b.forbids_playing, b.forbids_chatting,
+	i.hash, c.name, c.ip::text, c.ip::inet = $1::inet
+from bans as b
+join identities as i on i.id = b.identity or i.account = b.account
+join chatlog as c on c.pkey = i.pkey
+where
+	(b.time_expires is null or b.time_expires > now()) and
+	c.ip::inet <<= $2::cidr and
+	i.pkey != $3
+order by b.id desc, c.ip::inet = $1::inet desc
+limit 20`, []any{ip, subnet, pubkey},
+		[]any{&c.ban.Id, &c.ban.Issued, &expires, &reason, &fJoining, &fPlaying, &fChat, &c.hash, &c.name, &c.ip, &c.sameIP},
+		func(_ pgx.QueryFuncRow) error {
+			n := c
+			n.ban.Expires = expires
+			if reason != nil {
+				n.ban.Reason = *reason
+			}
+			n.ban.ForbidsJoining = fJoining != nil && *fJoining
+			n.ban.ForbidsPlaying = fPlaying != nil && *fPlaying
+			n.ban.ForbidsChatting = fChat != nil && *fChat
+			n.ip, _, _ = strings.Cut(n.ip, "/")
+			ret = append(ret, &n)
+			return nil
+		})
+	return ret, err
+}
+
+// weights are configured with "evasion.weights.<signal>", score is capped at 1
+func evasionScore(c *joinCheckContext, cand *evasionCandidate, asn string) {
+	weight := func(k string, d float64) float64 {
+		return float64(tryCfgGetD(tryGetIntGen("evasion", "weights", k), int(d*100), c.inst.cfgs...)) / 100
+	}
+	add := func(w float64, why string) {
+		cand.score += w
+		cand.why = append(cand.why, why)
+	}
+	if cand.sameIP {
+		add(weight("sameIP", 0.5), "same ip")
+	} else {
+		add(weight("sameSubnet", 0.25), "same subnet")
+		// only cached lookups, candidates are not worth waiting for
+		if asn != "" {
+			rsp, ok := ISPchecker.Cached(cand.ip)
+			if ok && rsp.ASN == asn {
+				add(weight("sameASN", 0.15), "same asn")
+			}
+		}
+	}
+	if sim := nameSimilarity(c.name, cand.name); sim >= 0.7 {
+		add(weight("name", 0.25)*sim, fmt.Sprintf("name %q similarity %.2f", cand.name, sim))
+	}
+	recent := time.Duration(tryCfgGetD(tryGetIntGen("evasion", "recentBanHours"), 72, c.inst.cfgs...)) * time.Hour
+	if time.Since(cand.ban.Issued) < recent {
+		add(weight("recentBan", 0.15), "ban issued "+time.Since(cand.ban.Issued).Round(time.Minute).String()+" ago")
+	}
+	if c.account == nil {
+		add(weight("notLinked", 0.1), "not linked")
+	}
+	cand.score = min(cand.score, 1)
+}
+
+var (
+	evasionNotifiedLock sync.Mutex
+	evasionNotified     = map[string]time.Time{}
+)
+
+// players behind one CGNAT address would report same ban on every join
+func evasionShouldNotify(c *joinCheckContext, banID int) bool {
+	cooldown := time.Duration(tryCfgGetD(tryGetIntGen("evasion", "notifyCooldownMinutes"), 60, c.inst.cfgs...)) * time.Minute
+	k := fmt.Sprintf("%d %s", banID, c.hash)
+	evasionNotifiedLock.Lock()
+	defer evasionNotifiedLock.Unlock()
+	maps.DeleteFunc(evasionNotified, func(_ string, v time.Time) bool {
+		return time.Since(v) > cooldown
+	})
+	if _, ok := evasionNotified[k]; ok {
+		return false
+	}
+	evasionNotified[k] = time.Now()
+	return true
+}
+
+// opt-in, thresholds are percents, "evasion.notifyThreshold" only reports the
+// join to moderators, "evasion.applyThreshold" also applies restrictions of
+// the ban, "evasion.budgetMilliseconds" caps time spent in database
+func joinRuleEvasion(c *joinCheckContext) joinCheckVerdict {
+	if c.ban != nil && !c.ban.Expired {
+		return joinCheckVerdict{}
+	}
+	subnet := evasionSubnet(c.inst, c.ip)
+	if subnet == "" {
+		return joinCheckVerdict{}
+	}
+	budget := time.Duration(tryCfgGetD(tryGetIntGen("evasion", "budgetMilliseconds"), 300, c.inst.cfgs...)) * time.Millisecond
+	ctx, cancel := context.WithTimeout(context.Background(), budget)
+	defer cancel()
+	cands, err := evasionCandidates(ctx, c.ip, subnet, c.pubkey)
+	if err != nil {
+		c.inst.logger.Printf("Failed to look up evasion candidates: %s", err.Error())
+		c.input("error", err.Error())
+		return joinCheckVerdict{}
+	}
+	c.input("subnet", subnet)
+	c.input("candidates", len(cands))
+	if len(cands) == 0 {
+		return joinCheckVerdict{}
+	}
+	asn := ""
+	if rsp, ok := ISPchecker.Cached(c.ip); ok {
+		asn = rsp.ASN
+	}
+	var best *evasionCandidate
+	for _, cand := range cands {
+		evasionScore(c, cand, asn)
+		if best == nil || cand.score > best.score {
+			best = cand
+		}
+	}
+	notifyThreshold := float64(tryCfgGetD(tryGetIntGen("evasion", "notifyThreshold"), 50, c.inst.cfgs...)) / 100
+	applyThreshold := float64(tryCfgGetD(tryGetIntGen("evasion", "applyThreshold"), 90, c.inst.cfgs...)) / 100
+	c.input("banID", best.ban.Id)
+	c.input("bannedHash", best.hash)
+	c.input("score", best.score)
+	c.input("signals", best.why)
+	if best.score < notifyThreshold {
+		return joinCheckVerdict{}
+	}
+	apply := best.score >= applyThreshold
+	// report only matches are logged once per cooldown, applied ones always
+	// need action code for the rejection message
+	notify := c.dryRun || evasionShouldNotify(c, best.ban.Id)
+	c.input("notified", notify)
+	if !apply && !notify {
+		return joinCheckVerdict{fired: true}
+	}
+	ecode := c.logAction("%d [evasion] Join %q pkey %s matches ban M-%d of %s with score %.2f (%s), applied %v",
+		c.inst.Id, c.name, c.pubkeyB64, best.ban.Id, best.hash, best.score, strings.Join(best.why, ", "), apply)
+	if notify {
+		c.notify("evasion", ecode, fmt.Sprintf("Matches ban M-%d of %s, score %.2f: %s, restrictions applied: %v",
+			best.ban.Id, best.hash, best.score, strings.Join(best.why, ", "), apply))
+	}
+	if !apply {
+		return joinCheckVerdict{fired: true}
+	}
+	return joinCheckBanVerdict(c, &best.ban, "M-"+strconv.Itoa(best.ban.Id)+" ("+ecode+")")
+}
+
+// 1 - levenshtein distance over length of longer name, case insensitive
+func nameSimilarity(a, b string) float64 {
+	ra := []rune(strings.ToLower(strings.TrimSpace(a)))
+	rb := []rune(strings.ToLower(strings.TrimSpace(b)))
+	if len(ra) == 0 || len(rb) == 0 {
+		return 0
+	}
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return 1 - float64(prev[len(rb)])/float64(max(len(ra), len(rb)))
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestNameSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want float64
+	}{
+		{"Player", "Player", 1},
+		{"Player", " pLAYER ", 1},
+		{"Player", "Player2", 1 - 1.0/7},
+		{"abcd", "abce", 0.75},
+		{"abc", "xyz", 0},
+		{"", "Player", 0},
+		{"  ", "", 0},
+		{"Игрок", "игрок1", 1 - 1.0/6},
+	}
+	for _, tt := range tests {
+		got := nameSimilarity(tt.a, tt.b)
+		if math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("nameSimilarity(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+		if rev := nameSimilarity(tt.b, tt.a); math.Abs(rev-got) > 1e-9 {
+			t.Errorf("nameSimilarity is not symmetric for %q and %q: %v vs %v", tt.a, tt.b, got, rev)
+		}
+	}
+}
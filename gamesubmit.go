@@ -26,6 +26,9 @@ func submitReport(inst *instance, reportBytes []byte) {
 			inst.logger.Printf("Failed to save instance recovery json: %s", err.Error())
 			discordPostError("Failed to save instance recovery json: %s (instance %d)", err.Error(), inst.Id)
 		}
+		if inst.GameId > 0 {
+			webhookFire(webhookEventGameBegun, inst, nil)
+		}
 	} else {
 		submitFrame(inst, reportBytes)
 	}
@@ -96,10 +99,6 @@ func submitBegin(inst *instance, reportBytes []byte) int {
 	return gid
 }
 
-var (
-	frameErrorSuspends = map[int64]string{}
-)
-
 func submitFrame(inst *instance, reportBytes []byte) {
 	report := gamereport.GameReport{}
 	err := json.Unmarshal(reportBytes, &report)
@@ -170,17 +169,7 @@ func flushStagingGraphs(inst *instance) {
 	}
 	if !tag.Update() || tag.RowsAffected() != 1 {
 		inst.logger.Printf("SUS tag while adding game: %s (gid %d)", tag, inst.GameId)
-		errMsgToSend := fmt.Sprintf("SUS tag while adding game: %s (gid %d) (instance %d)", tag, inst.GameId, inst.Id)
-		errMsg, ok := frameErrorSuspends[inst.Id]
-		if !ok {
-			discordPostError("%s", errMsgToSend)
-			frameErrorSuspends[inst.Id] = errMsgToSend
-		} else {
-			if errMsg != errMsgToSend {
-				discordPostError("%s", errMsgToSend)
-				frameErrorSuspends[inst.Id] = errMsgToSend
-			}
-		}
+		discordPostError("SUS tag while adding game: %s (gid %d) (instance %d)", tag, inst.GameId, inst.Id)
 	}
 	inst.StagingGraphs = []gamereport.GameReportGraphFrame{}
 }
@@ -215,7 +204,30 @@ func submitEnd(inst *instance, reportBytes []byte) {
 	if err != nil {
 		inst.logger.Printf("Failed to finalize: %s (gid %d)", err.Error(), inst.GameId)
 		discordPostError("Failed to finalize: %s (gid %d) (instance %d)", err.Error(), inst.GameId, inst.Id)
+		return
 	}
+	ratingProcessGame(inst, report)
+	tournamentOnGameEnd(inst, report)
+	players := []map[string]any{}
+	for _, v := range report.PlayerData {
+		if v.PublicKey == "" {
+			continue
+		}
+		players = append(players, map[string]any{
+			"position":  v.Position,
+			"team":      v.Team,
+			"name":      v.Name,
+			"publicKey": v.PublicKey,
+			"usertype":  v.Usertype,
+		})
+	}
+	webhookFire(webhookEventGameFinalized, inst, map[string]any{
+		"gameTime":       report.GameTime,
+		"endDate":        report.EndDate,
+		"timeout":        report.Game.Timeout,
+		"debugTriggered": inst.DebugTriggered,
+		"players":        players,
+	})
 }
 
 func sendReplayToStorage(inst *instance) {
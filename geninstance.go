@@ -1,6 +1,7 @@
 package main
 
 import (
+	"autohoster-backend/mapstorage"
 	"context"
 	"encoding/json"
 	"errors"
@@ -8,7 +9,6 @@ import (
 	"io"
 	"io/fs"
 	"log"
-	"math/rand"
 	"net/http"
 	"os"
 	"path"
@@ -18,7 +18,8 @@ import (
 	"github.com/maxsupermanhd/lac/v2"
 )
 
-func generateInstance(instcfg lac.Conf) (inst *instance, err error) {
+// queueName is the queue preset comes from, it keys map rotation history
+func generateInstance(instcfg lac.Conf, queueName string) (inst *instance, err error) {
 	inst, err = allocateNewInstance()
 	if err != nil {
 		return
@@ -36,7 +37,7 @@ func generateInstance(instcfg lac.Conf) (inst *instance, err error) {
 		return
 	}
 
-	err = geniMap(inst)
+	err = geniMap(inst, queueName)
 	if err != nil {
 		return
 	}
@@ -57,6 +58,11 @@ func generateInstance(instcfg lac.Conf) (inst *instance, err error) {
 		inst.RestoreCfgs = append(inst.RestoreCfgs, m)
 	}
 
+	err = geniMapFile(inst)
+	if err != nil {
+		return
+	}
+
 	inst.Admins, inst.AdminsPolicy = geniAdminspolicy(inst)
 
 	err = geniPreset(inst)
@@ -143,7 +149,7 @@ func geniActions(inst *instance) error {
 	return nil
 }
 
-func geniMap(inst *instance) error {
+func geniMap(inst *instance, queueName string) error {
 	mapnames, ok := inst.cfg.GetKeys("maps")
 	if !ok {
 		return errors.New("no maps defined for preset")
@@ -151,8 +157,7 @@ func geniMap(inst *instance) error {
 	if len(mapnames) == 0 {
 		return errors.New("map list is empty")
 	}
-	mapn := rand.Intn(len(mapnames))
-	inst.Settings.MapName = mapnames[mapn]
+	inst.Settings.MapName = mapRotationPick(inst, queueName, mapnames)
 	inst.Settings.MapHash, ok = inst.cfg.GetString("maps", inst.Settings.MapName, "hash")
 	if !ok {
 		return errors.New("map hash not defined")
@@ -160,14 +165,33 @@ func geniMap(inst *instance) error {
 	if !ok {
 		return errors.New("map players not defined")
 	}
+	return nil
+}
 
+// needs cfgs of picked map for player count
+func geniMapFile(inst *instance) error {
 	mapbytes, err := ms.GetMap(inst.Settings.MapHash)
 	if err != nil {
 		return err
 	}
+	md, err := mapstorage.ParseMapMetadata(mapbytes)
+	if err != nil {
+		inst.logger.Printf("Failed to read map metadata: %s", err.Error())
+	} else {
+		players := tryCfgGetD(tryGetIntGen("players"), -1, inst.cfgs...)
+		if md.Players != players {
+			return fmt.Errorf("map %q is for %d players but preset expects %d", inst.Settings.MapName, md.Players, players)
+		}
+	}
 	return os.WriteFile(path.Join(inst.ConfDir, "maps", inst.Settings.MapHash+".wz"), mapbytes, 0644)
 }
 
+// leaves only one map in the preset so geniMap has nothing else to pick from
+func cfgRestrictMap(c lac.Conf, mapName string) {
+	mapCfg, _ := c.Get("maps", mapName)
+	c.Set(map[string]any{mapName: mapCfg}, "maps")
+}
+
 func geniPreset(inst *instance) error {
 	inst.Settings.TimeLimit = tryCfgGetD(tryGetIntGen("timelimit"), 2, inst.cfgs...)
 	inst.Settings.FrameInterval = tryCfgGetD(tryGetIntGen("frameinterval"), 1, inst.cfgs...)
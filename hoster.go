@@ -80,6 +80,7 @@ func spawnRunner(inst *instance) {
 
 	pr.Release()
 	inst.logger.Printf("Started with pid %d", inst.Pid)
+	webhookFire(webhookEventInstanceCreated, inst, nil)
 
 	inst.logger.Println("Reopening pipes...")
 	err = inst.stdin.Close()
@@ -164,7 +165,7 @@ func instanceRunner(inst *instance) {
 		pokeHosterRunner(inst, exitchan)
 		wg.Done()
 	}()
-	if inst.Origin == "requested" && instanceState(inst.state.Load()) <= instanceStateInLobby {
+	if (inst.Origin == "requested" || inst.Origin == "matchmaking" || inst.Origin == "tournament") && instanceState(inst.state.Load()) <= instanceStateInLobby {
 		wg.Add(1)
 		go func() {
 			runnerRoutineRequestedWatchdog(inst, exitchan)
@@ -251,6 +252,24 @@ msgloop:
 					continue
 				}
 				instWriteFmt(inst, "chat bcast %s", nonAlphanumericRegex.ReplaceAllString(s, ""))
+			case icDirectMessage:
+				d, ok := cmd.data.(instanceCommandDirectMessage)
+				if !ok {
+					inst.logger.Printf("wrong icDirectMessage data type! (%t)", cmd.data)
+					continue
+				}
+				instWriteFmt(inst, "chat direct %s %s", d.pubkeyB64, d.message)
+			case icMapVoteEnd:
+				mapVoteFinish(inst)
+			case icMapVoteFailed:
+				mapVoteFailed(inst)
+			case icBanEnforce:
+				d, ok := cmd.data.(instanceCommandBanEnforce)
+				if !ok {
+					inst.logger.Printf("wrong icBanEnforce data type! (%t)", cmd.data)
+					continue
+				}
+				banEnforceInRoom(inst, d)
 			case icShutdown:
 				inst.logger.Println("exit sent")
 				instWriteFmt(inst, "shutdown now")
@@ -261,6 +280,11 @@ msgloop:
 				if err != nil {
 					inst.logger.Printf("Failed to save instance recovery json: %s", err.Error())
 				}
+			case icRecoverSave:
+				err := recoverSave(inst)
+				if err != nil {
+					inst.logger.Printf("Failed to save instance recovery json: %s", err.Error())
+				}
 			case icRunnerStop:
 				inst.logger.Println("runner stopping")
 				inst.logger.Printf("atomic state store: %d", int64(instanceStateExiting))
@@ -311,6 +335,8 @@ msgloop:
 	err = archiveInstance(inst.ConfDir)
 	if err != nil {
 		inst.logger.Printf("Runner failed to archive itself: %s", err.Error())
+	} else {
+		webhookFire(webhookEventInstanceArchived, inst, nil)
 	}
 	inst.logger.Println("Runner exits")
 	inst.logger.Printf("atomic state store: %d", int64(instanceStateExited))
@@ -329,9 +355,10 @@ func runnerRoutineRequestedWatchdog(inst *instance, exitchan chan struct{}) {
 			inst.logger.Printf("requested room watchdog exited for ingame")
 			return
 		}
-		if inst.Id+600 < time.Now().Unix() {
-			// too early to kill it
-			return
+		// instance id is its creation time, players need time to connect
+		if inst.Id+int64(tryCfgGetD(tryGetIntGen("requestedWatchdogGraceSeconds"), 600, inst.cfgs...)) > time.Now().Unix() {
+			time.Sleep(3 * time.Second)
+			continue
 		}
 		rs := inst.RoomStatus.DupSubTree()
 		foundPlayer := false
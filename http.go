@@ -7,6 +7,8 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"os"
+	"strings"
 	"sync"
 	"time"
 
@@ -20,6 +22,28 @@ func routineWebServer(closechan <-chan struct{}) {
 	m.HandleFunc("/config/get", webHandleConfigGet)
 	m.HandleFunc("/alive", webHandleAlive)
 	m.HandleFunc("/request", webHandleRequestRoom)
+	m.HandleFunc("/errors", webHandleErrors)
+	m.HandleFunc("/discord/interactions", webHandleDiscordInteractions)
+	m.HandleFunc("/matchmaking", webHandleMatchmaking)
+	m.HandleFunc("/matchmaking/join", webHandleMatchmakingJoin)
+	m.HandleFunc("/matchmaking/leave", webHandleMatchmakingLeave)
+	m.HandleFunc("/invite/redeem", webHandleInviteRedeem)
+	m.HandleFunc("/tournaments", webHandleTournaments)
+	m.HandleFunc("/tournaments/create", webHandleTournamentCreate)
+	m.HandleFunc("/tournaments/result", webHandleTournamentResult)
+	m.HandleFunc("/schedules", webHandleSchedules)
+	m.HandleFunc("/queues/demand", webHandleQueueDemand)
+	m.HandleFunc("/maps/metadata", webHandleMapMetadata)
+	m.HandleFunc("/maps/validate", webHandleMapValidate)
+	m.HandleFunc("/joincheck/explain", webHandleJoinCheckExplain)
+	m.HandleFunc("/joindecisions", webHandleJoinDecisions)
+	m.HandleFunc("/bans", webHandleBans)
+	m.HandleFunc("/bans/issue", webHandleBanIssue)
+	m.HandleFunc("/bans/edit", webHandleBanEdit)
+	m.HandleFunc("/bans/revoke", webHandleBanRevoke)
+	m.HandleFunc("/ipbans", webHandleIPBans)
+	m.HandleFunc("/ipbans/revoke", webHandleIPBanRevoke)
+	m.HandleFunc("/messages", webHandleMessages)
 	var wg sync.WaitGroup
 	wg.Add(1)
 	srv := http.Server{
@@ -79,13 +103,39 @@ func webHandleInstances(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte("\n"))
 }
 
+func webHandleErrors(w http.ResponseWriter, r *http.Request) {
+	webRespondJSON(w, errorReports.snapshot())
+}
+
+// config with queue maps not matching their metadata is refused unless
+// "force" is set (mirror outage should not block unrelated changes)
 func webHandleConfigReload(w http.ResponseWriter, r *http.Request) {
-	err := cfg.SetFromFileJSON("config.json")
+	b, err := os.ReadFile("config.json")
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error() + "\n"))
+		return
+	}
+	nc, err := lac.FromBytesJSON(b)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error() + "\n"))
+		return
+	}
+	problems := validateQueueMaps(nc)
+	if len(problems) > 0 && r.URL.Query().Get("force") == "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(problems)
+		return
+	}
+	err = cfg.SetFromBytesJSON(b)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		w.Write([]byte(err.Error() + "\n"))
 		return
 	}
+	ms.Pin(queueMapHashes()...)
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("Config reloaded"))
 	w.Write([]byte("\n"))
@@ -124,20 +174,202 @@ func webHandleRequestRoom(w http.ResponseWriter, r *http.Request) {
 		discordPostError("HTTP room request: failed to unmarshal json: %s", err.Error())
 		return
 	}
-	gi, err := generateInstance(c)
+	gi, err := spawnRequestedInstance(c)
 	if err != nil {
 		log.Printf("HTTP room request: failed to generate instance: %s", err.Error())
 		discordPostError("HTTP room request: failed to generate instance: %s", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(fmt.Sprintf("Room created, join with %s", instanceJoinAddress(gi))))
+	w.Write([]byte("\n"))
+	if gi.Access != nil {
+		codes := gi.Access.unusedInviteCodes()
+		if len(codes) > 0 {
+			w.Write([]byte(fmt.Sprintf("Invite codes: %s", strings.Join(codes, " "))))
+			w.Write([]byte("\n"))
+		}
+	}
+}
+
+func spawnRequestedInstance(c lac.Conf) (*instance, error) {
+	gi, err := generateInstance(c, "")
+	if err != nil {
 		if gi != nil {
 			releaseInstance(gi)
 		}
-		w.WriteHeader(http.StatusInternalServerError)
-		return
+		return nil, err
 	}
 	gi.QueueName = ""
 	gi.Origin = "requested"
+	gi.Access = accessFromRequest(c)
 	go spawnRunner(gi)
+	return gi, nil
+}
+
+func instanceJoinAddress(inst *instance) string {
+	return fmt.Sprintf("%s:%d", cfg.GetDString("host.wz2100-autohost.net", "publicHostname"), inst.Settings.GamePort)
+}
+
+func webHandleMatchmaking(w http.ResponseWriter, r *http.Request) {
+	webRespondJSON(w, matchmakingSnapshot())
+}
+
+func webHandleMatchmakingJoin(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Pubkey string   `json:"pubkey"`
+		Name   string   `json:"name"`
+		IP     string   `json:"ip"`
+		Queues []string `json:"queues"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error() + "\n"))
+		return
+	}
+	t, err := matchmakingRegister(req.Pubkey, req.Name, req.IP, req.Queues, 0)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error() + "\n"))
+		return
+	}
+	webRespondJSON(w, t)
+}
+
+func webHandleMatchmakingLeave(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Pubkey string `json:"pubkey"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error() + "\n"))
+		return
+	}
+	if !matchmakingUnregister(req.Pubkey) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
 	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(fmt.Sprintf("Room created, join with host.wz2100-autohost.net:%d", gi.Settings.GamePort)))
+}
+
+func webHandleQueueDemand(w http.ResponseWriter, r *http.Request) {
+	ret := map[string]any{}
+	for k, v := range queueDemandSnapshot() {
+		ret[k] = map[string]any{
+			"stats":   v,
+			"desired": queueDesiredLobbyRooms(k),
+		}
+	}
+	webRespondJSON(w, ret)
+}
+
+func webHandleMapMetadata(w http.ResponseWriter, r *http.Request) {
+	hash := r.URL.Query().Get("hash")
+	if hash == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("hash is required\n"))
+		return
+	}
+	md, err := ms.GetMapMetadata(hash)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(err.Error() + "\n"))
+		return
+	}
+	webRespondJSON(w, md)
+}
+
+func webHandleMapValidate(w http.ResponseWriter, r *http.Request) {
+	webRespondJSON(w, validateQueueMaps(cfg))
+}
+
+func webHandleInviteRedeem(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Code string `json:"code"`
+		Hash string `json:"hash"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error() + "\n"))
+		return
+	}
+	if req.Code == "" || req.Hash == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("code and hash are required\n"))
+		return
+	}
+	inst, err := redeemInviteCode(req.Code, req.Hash)
+	if err != nil {
+		if errors.Is(err, errInviteCodeNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+		} else {
+			w.WriteHeader(http.StatusConflict)
+		}
+		w.Write([]byte(err.Error() + "\n"))
+		return
+	}
+	webRespondJSON(w, map[string]any{
+		"instance": inst.Id,
+		"address":  instanceJoinAddress(inst),
+	})
+}
+
+func webHandleJoinCheckExplain(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		Pubkey   string `json:"pubkey"`
+		IP       string `json:"ip"`
+		Name     string `json:"name"`
+		Queue    string `json:"queue"`
+		Instance int64  `json:"instance"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error() + "\n"))
+		return
+	}
+	if req.Pubkey == "" || req.IP == "" || (req.Queue == "" && req.Instance == 0) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("pubkey, ip and queue or instance are required\n"))
+		return
+	}
+	res, err := joinCheckExplain(req.Instance, req.Queue, req.IP, req.Name, req.Pubkey)
+	if err != nil {
+		if errors.Is(err, errInstanceNotFound) || errors.Is(err, errJoinCheckQueueNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+		} else {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+		w.Write([]byte(err.Error() + "\n"))
+		return
+	}
+	webRespondJSON(w, map[string]any{
+		"action":    res.Action.Name(),
+		"reason":    res.Reason,
+		"account":   res.Account,
+		"allowChat": res.Dispatch.AllowChat,
+		"messages":  res.Dispatch.Messages,
+		"trace":     res.Trace,
+	})
+}
+
+func webRespondJSON(w http.ResponseWriter, v any) {
+	b, err := json.MarshalIndent(v, "", "\t")
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error() + "\n"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(b)
 	w.Write([]byte("\n"))
 }
@@ -20,22 +20,24 @@ func processLinkingMessage(inst *instance, args string, e chatCommandExecutor) {
 	ctx, ctxCancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer ctxCancel()
 
+	lang := msgPlayerLang(inst, e.publicKeyB64)
+
 	var accountID int
 	var emailConfirmed *time.Time
 	err := dbpool.QueryRow(ctx, `select id, email_confirmed from accounts where wz_confirm_code = $1`, confirmCode).Scan(&accountID, &emailConfirmed)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			instWriteFmt(inst, `chat direct %s %s`, e.publicKeyB64, "⚠ Invalid code, please get one at https://wz2100-autohost.net/wzlink")
+			instWriteFmt(inst, `chat direct %s %s`, e.publicKeyB64, msgT(inst, lang, "link.invalidCode"))
 			return
 		} else {
-			instWriteFmt(inst, `chat direct %s %s`, e.publicKeyB64, "⚠ Something went wrong, contact administrators for assistance.")
+			instWriteFmt(inst, `chat direct %s %s`, e.publicKeyB64, msgT(inst, lang, "link.error"))
 			discordPostError(`%s\n%s`, err.Error(), string(debug.Stack()))
 			return
 		}
 	}
 
 	if emailConfirmed == nil {
-		instWriteFmt(inst, `chat direct %s %s`, e.publicKeyB64, "⚠ Email not confirmed. Please confirm your email to link an identity. If you need to re-send confirmation email or change your address contact Administrators.")
+		instWriteFmt(inst, `chat direct %s %s`, e.publicKeyB64, msgT(inst, lang, "link.unconfirmed"))
 		return
 	}
 
@@ -48,11 +50,11 @@ func processLinkingMessage(inst *instance, args string, e chatCommandExecutor) {
 			return err
 		}
 		if tag.RowsAffected() == 0 {
-			instWriteFmt(inst, `chat direct %s %s`, e.publicKeyB64, "⚠ Identity already claimed, contact administrators if you are confused.")
+			instWriteFmt(inst, `chat direct %s %s`, e.publicKeyB64, msgT(inst, lang, "link.claimed"))
 			return nil
 		}
 		if tag.RowsAffected() > 1 {
-			instWriteFmt(inst, `chat direct %s %s`, e.publicKeyB64, "⚠ Something went wrong, contact administrators for assistance.")
+			instWriteFmt(inst, `chat direct %s %s`, e.publicKeyB64, msgT(inst, lang, "link.error"))
 			discordPostError(`sus tag %s on identity insert\n%s`, tag, string(debug.Stack()))
 			return nil
 		}
@@ -63,11 +65,13 @@ func processLinkingMessage(inst *instance, args string, e chatCommandExecutor) {
 		if !tag.Update() || tag.RowsAffected() != 1 {
 			discordPostError(`sus tag %s on account confirm code clear while linking\n%s`, tag, string(debug.Stack()))
 		}
-		instWriteFmt(inst, `chat direct %s %s`, e.publicKeyB64, "☑ Identity linked successfully")
+		instWriteFmt(inst, `chat direct %s %s`, e.publicKeyB64, msgT(inst, lang, "link.success"))
+		// account may have its own language
+		delete(inst.playerLangs, e.publicKeyB64)
 		return nil
 	})
 	if err != nil {
-		instWriteFmt(inst, `chat direct %s %s`, e.publicKeyB64, "⚠ Something went wrong, contact administrators for assistance.")
+		instWriteFmt(inst, `chat direct %s %s`, e.publicKeyB64, msgT(inst, lang, "link.error"))
 		discordPostError(`identity linking tx error %s\n%s`, err.Error(), string(debug.Stack()))
 		return
 	}
@@ -32,9 +32,21 @@ const (
 )
 
 type joinDispatch struct {
-	AllowChat bool
-	Messages  []string
-	Issued    time.Time
+	AllowChat        bool
+	Messages         []string
+	Issued           time.Time
+	Reserved         bool
+	ReservedMessages []string
+	Lang             string
+}
+
+type instanceAccess struct {
+	Pubkeys         []string
+	Hashes          []string
+	Accounts        []int
+	InviteCodes     map[string]string
+	AllowSpectators bool
+	lock            sync.Mutex
 }
 
 type instanceSettings struct {
@@ -60,6 +72,7 @@ type instance struct {
 	AdminsPolicy        adminsPolicy
 	Origin              string
 	OnJoinDispatch      map[string]joinDispatch
+	Access              *instanceAccess
 	QueueName           string
 	AutodetectedVersion string
 	state               atomic.Int64
@@ -80,4 +93,9 @@ type instance struct {
 	StagingGraphs       []gamereport.GameReportGraphFrame
 	pokeRequests        chan int
 	pokeCancels         chan string
+	readyPlayers        map[string]int
+	playerLangs         map[string]string
+	lobbyJoinTimes      map[string]time.Time
+	balanceApplied      string
+	mapVote             *mapVoteState
 }
@@ -8,18 +8,18 @@ import (
 func instanceChatCommandHandlerPoke(inst *instance, args string, e chatCommandExecutor) {
 	slotnum, err := strconv.Atoi(args)
 	if err != nil || slotnum < 0 || slotnum > inst.Settings.PlayerCount {
-		instWriteFmt(inst, `chat bcast ⚠ Poke requires numerical player slot as argument!`)
+		instWriteFmt(inst, `chat bcast %s`, msgT(inst, msgRoomLang(inst), "poke.usage"))
 		return
 	}
 	if !checkPkeyHasAccount(e.publicKey) {
-		instWriteFmt(inst, `chat bcast ⚠ Poke is only available for registered players! (https://wz2100-autohost.net/register)`)
+		instWriteFmt(inst, `chat bcast %s`, msgT(inst, msgRoomLang(inst), "poke.registered"))
 		return
 	}
 	select {
 	case inst.pokeRequests <- slotnum:
 		inst.logger.Printf("poke initiated")
 	default:
-		instWriteFmt(inst, `chat bcast ⚠ Failed to process poke!`)
+		instWriteFmt(inst, `chat bcast %s`, msgT(inst, msgRoomLang(inst), "poke.failed"))
 		return
 	}
 }
@@ -28,6 +28,7 @@ func pokeHosterRunner(inst *instance, exitchan chan struct{}) {
 	lastPoke := time.Now()
 	pokeCurrentSlot := -1
 	pokeInitialCountdown := 15
+	lang := msgRoomLang(inst)
 	pokeCountdown := -1
 	pokeTimer := time.NewTimer(1 * time.Second)
 	pokeTimer.Stop()
@@ -57,29 +58,29 @@ func pokeHosterRunner(inst *instance, exitchan chan struct{}) {
 			return
 		case requestedSlot := <-inst.pokeRequests:
 			if pokeCurrentSlot != -1 {
-				instWriteFmt(inst, `chat bcast ⚠ Poke for slot %d is ongoing!`, pokeCurrentSlot)
+				instWriteFmt(inst, `chat bcast %s`, msgT(inst, lang, "poke.ongoing", "slot", strconv.Itoa(pokeCurrentSlot)))
 				continue
 			}
 			cooldownSeconds := tryCfgGetD(tryGetIntGen("pokeCooldownSeconds"), 0, inst.cfgs...)
 			if cooldownSeconds == 0 {
-				instWriteFmt(inst, `chat bcast ⚠ Poke is disabled in this room!`)
+				instWriteFmt(inst, `chat bcast %s`, msgT(inst, lang, "poke.disabled"))
 				continue
 			}
 			sinceLastPoke := time.Since(lastPoke)
 			if sinceLastPoke < time.Duration(cooldownSeconds)*time.Second {
 				pokeEta := (time.Duration(cooldownSeconds)*time.Second - sinceLastPoke).Round(time.Second)
-				instWriteFmt(inst, `chat bcast ⚠ Poke is on cooldown! (available in %s)`, pokeEta.String())
+				instWriteFmt(inst, `chat bcast %s`, msgT(inst, lang, "poke.cooldown", "eta", pokeEta.String()))
 				continue
 			}
 			pokeCountdown = tryCfgGetD(tryGetIntGen("pokeCountdownSeconds"), 15, inst.cfgs...)
 			if pokeCountdown < 2 {
-				instWriteFmt(inst, `chat bcast ⚠ Poke is disabled in this room! (via countdown)`)
+				instWriteFmt(inst, `chat bcast %s`, msgT(inst, lang, "poke.disabledCountdown"))
 				continue
 			}
 			pokeInitialCountdown = pokeCountdown
 			slotDataIP = roomStatusPlayerSlotToPropertyString(inst.RoomStatus.DupSubTree(), requestedSlot, "ip")
 			if slotDataIP == "" {
-				instWriteFmt(inst, `chat bcast ⚠ Poke failed to locate player.`)
+				instWriteFmt(inst, `chat bcast %s`, msgT(inst, lang, "poke.notFound"))
 				continue
 			}
 			pokeCurrentSlot = requestedSlot
@@ -95,7 +96,7 @@ func pokeHosterRunner(inst *instance, exitchan chan struct{}) {
 				continue
 			}
 			if cancelIP == slotDataIP {
-				instWriteFmt(inst, `chat bcast ⚠ Poke has been cancelled for slot %d.`, pokeCurrentSlot)
+				instWriteFmt(inst, `chat bcast %s`, msgT(inst, lang, "poke.cancelled", "slot", strconv.Itoa(pokeCurrentSlot)))
 				pokeCurrentSlot = -1
 				pokeCountdown = -1
 				pokeTimer.Stop()
@@ -111,13 +112,13 @@ func pokeHosterRunner(inst *instance, exitchan chan struct{}) {
 				continue
 			}
 			if slotDataIP == "" {
-				instWriteFmt(inst, `chat bcast ⚠ Poke lost target.`)
+				instWriteFmt(inst, `chat bcast %s`, msgT(inst, lang, "poke.lostTarget"))
 				inst.logger.Println("poke timer poked empty ip")
 				continue
 			}
 			pk := roomStatusPlayerSlotToPropertyString(inst.RoomStatus.DupSubTree(), pokeCurrentSlot, "pk")
 			if pk == "" {
-				instWriteFmt(inst, `chat bcast ⚠ Poke lost target.`)
+				instWriteFmt(inst, `chat bcast %s`, msgT(inst, lang, "poke.lostTarget"))
 				pokeCurrentSlot = -1
 				pokeCountdown = -1
 				pokeTimer.Stop()
@@ -131,7 +132,7 @@ func pokeHosterRunner(inst *instance, exitchan chan struct{}) {
 			if pokeCountdown == 0 {
 				slotValidateIP := roomStatusPlayerSlotToPropertyString(inst.RoomStatus.DupSubTree(), pokeCurrentSlot, "ip")
 				if slotValidateIP != slotDataIP {
-					instWriteFmt(inst, `chat bcast ⚠ Poke lost target.`)
+					instWriteFmt(inst, `chat bcast %s`, msgT(inst, lang, "poke.lostTarget"))
 					pokeCurrentSlot = -1
 					pokeCountdown = -1
 					if pokeTimer.Stop() {
@@ -143,7 +144,7 @@ func pokeHosterRunner(inst *instance, exitchan chan struct{}) {
 					slotDataIP = ""
 					continue
 				}
-				instWriteFmt(inst, `ban ip %s You got kicked for afk. You can rejoin immediately. If you feel like it is being abused, contact administrators.`, slotDataIP)
+				instWriteFmt(inst, `ban ip %s %s`, slotDataIP, msgT(inst, lang, "kick.afk"))
 				instWriteFmt(inst, `unban ip %s`, slotDataIP)
 				pokeCurrentSlot = -1
 				pokeCountdown = -1
@@ -156,9 +157,9 @@ func pokeHosterRunner(inst *instance, exitchan chan struct{}) {
 				continue
 			}
 			if pokeCountdown == pokeInitialCountdown || pokeCountdown%5 == 0 || pokeCountdown <= 3 {
-				instWriteFmt(inst, `chat bcast ⚠ Poke will kick slot %d for being afk in %d.`, pokeCurrentSlot, pokeCountdown)
+				instWriteFmt(inst, `chat bcast %s`, msgT(inst, lang, "poke.countdown", "slot", strconv.Itoa(pokeCurrentSlot), "seconds", strconv.Itoa(pokeCountdown)))
 			}
-			instWriteFmt(inst, `chat direct %s ⚠ Poke will kick YOU for being afk in %d seconds! (write in chat to show activity)`, pk, pokeCountdown)
+			instWriteFmt(inst, `chat direct %s %s`, pk, msgT(inst, lang, "poke.countdownYou", "seconds", strconv.Itoa(pokeCountdown)))
 			pokeTimer.Stop()
 			select {
 			case <-pokeTimer.C:
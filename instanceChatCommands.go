@@ -23,7 +23,7 @@ func instanceChatCommandHandle(inst *instance, msg string, invhash, invb64pkey s
 	}
 	cmd, args := popWord(msg)
 	if cmd == "/stat" || cmd == "/stats" {
-		instWriteFmt(inst, `chat bcast Game history of Autohoster is available at the website: https://wz2100-autohost.net/games (with detailed statistics, charts and replay for download)`)
+		instWriteFmt(inst, `chat bcast %s`, msgT(inst, msgRoomLang(inst), "chat.stats"))
 	} else if cmd == "/hostmsg" {
 		processLinkingMessage(inst, args, e)
 	} else if cmd == "/votekick" {
@@ -32,6 +32,12 @@ func instanceChatCommandHandle(inst *instance, msg string, invhash, invb64pkey s
 		instanceChatCommandHandlerSet(inst, args, e)
 	} else if cmd == "/poke" {
 		instanceChatCommandHandlerPoke(inst, args, e)
+	} else if cmd == "/queue" {
+		instanceChatCommandHandlerQueue(inst, args, e)
+	} else if cmd == "/mapvote" {
+		instanceChatCommandHandlerMapVote(inst, args, e)
+	} else if cmd == "/invite" {
+		instanceChatCommandHandlerInvite(inst, args, e)
 	} else if cmd == "/help" {
 		instanceChatCommandHandlerHelp(inst, args, e)
 	}
@@ -41,6 +47,15 @@ func instanceChatCommandHandlerHelp(inst *instance, args string, e chatCommandEx
 	instWriteFmt(inst, `chat direct %s /votekick (Player ID: first 3 symbols) - initiates votekick for identity`, e.publicKeyB64)
 	instWriteFmt(inst, `chat direct %s /poke (slot number from 0) - [registered only] initiate afk kick countdown`, e.publicKeyB64)
 	instWriteFmt(inst, `chat direct %s /set ... - [admin] configure the room preferences`, e.publicKeyB64)
+	if tryCfgGetD(tryGetBoolGen("matchmakingWaitingRoom"), false, inst.cfgs...) {
+		instWriteFmt(inst, `chat direct %s /queue [queue names] - search for a game, /queue leave - stop searching`, e.publicKeyB64)
+	}
+	if tryCfgGetD(tryGetBoolGen("mapVote", "enabled"), false, inst.cfgs...) {
+		instWriteFmt(inst, `chat direct %s /mapvote - start a vote to change the map, /mapvote (number) - vote for a map`, e.publicKeyB64)
+	}
+	if inst.Access != nil {
+		instWriteFmt(inst, `chat direct %s /invite (code) - use invite code to take a player slot in this private room`, e.publicKeyB64)
+	}
 }
 
 func popWord(msg string) (part, rem string) {
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+type ipBan struct {
+	Id              int
+	Network         string
+	Reason          string
+	Issuer          string
+	Issued          time.Time
+	Expires         *time.Time
+	ForbidsJoining  bool
+	ForbidsPlaying  bool
+	ForbidsChatting bool
+}
+
+// single address is stored as /32 or /128 network
+func parseIPBanNetwork(s string) (string, error) {
+	if !strings.Contains(s, "/") {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return "", errors.New("invalid ip address")
+		}
+		if ip.To4() != nil {
+			return ip.String() + "/32", nil
+		}
+		return ip.String() + "/128", nil
+	}
+	_, n, err := net.ParseCIDR(s)
+	if err != nil {
+		return "", err
+	}
+	return n.String(), nil
+}
+
+func ipBansActive(ip string) ([]ipBan, error) {
+	ret := []ipBan{}
+	var b ipBan
+	_, err := dbpool.QueryFunc(context.Background(), `select
+	id, network::text, reason, issuer, time_issued, time_expires, forbids_joining, forbids_playing, forbids_chatting
+from ip_bans
+where $1::inet <<= network and (time_expires is null or time_expires > now())
+order by id desc`, []any{ip},
+		[]any{&b.Id, &b.Network, &b.Reason, &b.Issuer, &b.Issued, &b.Expires, &b.ForbidsJoining, &b.ForbidsPlaying, &b.ForbidsChatting},
+		func(_ pgx.QueryFuncRow) error {
+			ret = append(ret, b)
+			return nil
+		})
+	return ret, err
+}
+
+func ipBansList(all bool) ([]ipBan, error) {
+	ret := []ipBan{}
+	var b ipBan
+	_, err := dbpool.QueryFunc(context.Background(), `select
+	id, network::text, reason, issuer, time_issued, time_expires, forbids_joining, forbids_playing, forbids_chatting
+from ip_bans
+where $1 or time_expires is null or time_expires > now()
+order by id desc`, []any{all},
+		[]any{&b.Id, &b.Network, &b.Reason, &b.Issuer, &b.Issued, &b.Expires, &b.ForbidsJoining, &b.ForbidsPlaying, &b.ForbidsChatting},
+		func(_ pgx.QueryFuncRow) error {
+			ret = append(ret, b)
+			return nil
+		})
+	return ret, err
+}
+
+func ipBanIssue(b ipBan) (int, error) {
+	var err error
+	b.Network, err = parseIPBanNetwork(b.Network)
+	if err != nil {
+		return 0, err
+	}
+	if b.Reason == "" {
+		return 0, errors.New("reason is required")
+	}
+	if !b.ForbidsJoining && !b.ForbidsPlaying && !b.ForbidsChatting {
+		return 0, errors.New("ban must forbid something")
+	}
+	var id int
+	err = dbpool.QueryRow(context.Background(), `insert into ip_bans
+	(network, reason, issuer, time_expires, forbids_joining, forbids_playing, forbids_chatting)
+values
+	($1::cidr, $2, $3, $4, $5, $6, $7)
+returning id`, b.Network, b.Reason, b.Issuer, b.Expires, b.ForbidsJoining, b.ForbidsPlaying, b.ForbidsChatting).Scan(&id)
+	return id, err
+}
+
+// every active ban covering the address is folded into one, restrictions add up
+func joinRuleIPBans(c *joinCheckContext) joinCheckVerdict {
+	bans, err := ipBansActive(c.ip)
+	if err != nil {
+		c.inst.logger.Printf("Failed to request ip bans from database: %s", err.Error())
+		c.input("error", err.Error())
+		return joinCheckVerdict{}
+	}
+	c.input("bans", bans)
+	if len(bans) == 0 {
+		return joinCheckVerdict{}
+	}
+	merged := joinCheckBan{
+		Id:      bans[0].Id,
+		Issued:  bans[0].Issued,
+		Expires: bans[0].Expires,
+		Reason:  bans[0].Reason,
+	}
+	for _, b := range bans {
+		if b.ForbidsJoining && !merged.ForbidsJoining {
+			merged.Id, merged.Issued, merged.Expires, merged.Reason = b.Id, b.Issued, b.Expires, b.Reason
+		}
+		merged.ForbidsJoining = merged.ForbidsJoining || b.ForbidsJoining
+		merged.ForbidsPlaying = merged.ForbidsPlaying || b.ForbidsPlaying
+		merged.ForbidsChatting = merged.ForbidsChatting || b.ForbidsChatting
+	}
+	return joinCheckBanVerdict(c, &merged, "I-"+strconv.Itoa(merged.Id))
+}
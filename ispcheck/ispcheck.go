@@ -2,10 +2,11 @@ package ispcheck
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"io/fs"
 	"log"
+	"maps"
 	"net/http"
 	"os"
 	"sync"
@@ -15,24 +16,62 @@ import (
 )
 
 type ISPChecker struct {
-	cfg   lac.Conf
-	hcl   *http.Client
-	l     sync.Mutex
-	cache map[string]LookupResponse
+	cfg       lac.Conf
+	hcl       *http.Client
+	l         sync.Mutex
+	cache     map[string]cacheEntry
+	calls     map[string]*lookupCall
+	down      map[string]time.Time
+	dirty     bool
+	lastSave  time.Time
+	sl        sync.Mutex
+	pl        sync.Mutex
+	providers map[string]Provider
+}
+
+type cacheEntry struct {
+	LookupResponse
+	Fetched time.Time
+}
+
+// concurrent lookups of the same address wait for one provider request
+type lookupCall struct {
+	done chan struct{}
+	rsp  *LookupResponse
+	err  error
 }
 
 func NewISPChecker(cfg lac.Conf) *ISPChecker {
 	c, err := loadCache(cfgGetCachePath(cfg))
 	if err != nil {
 		log.Printf("Failed to load ISP cache: %s", err.Error())
-		c = map[string]LookupResponse{}
+		c = map[string]cacheEntry{}
+	}
+	// entries from old cache format have no fetch time, keep them as expired,
+	// "asnfile" entries used to have organization name as ASN, only "ipapi"
+	// used to answer with location
+	for k, e := range c {
+		if e.Provider == "" && e.Country != "" {
+			e.Provider = "ipapi"
+		}
+		if e.Fetched.IsZero() {
+			e.Fetched = time.Now().Add(-cfgGetCacheTTL(cfg))
+		}
+		if e.Country == "" && e.ASN != "" && e.ASN == e.Org {
+			e.ASN = ""
+		}
+		c[k] = e
 	}
 	return &ISPChecker{
 		cfg: cfg,
 		hcl: &http.Client{
 			Timeout: cfgGetTimeoutSeconds(cfg),
 		},
-		cache: c,
+		cache:     c,
+		calls:     map[string]*lookupCall{},
+		down:      map[string]time.Time{},
+		lastSave:  time.Now(),
+		providers: map[string]Provider{},
 	}
 }
 
@@ -49,70 +88,152 @@ func cfgGetCreatePerms(cfg lac.Conf) os.FileMode {
 }
 
 func cfgGetUrlFmt(cfg lac.Conf) string {
-	return cfg.GetDString("http://ip-api.com/json/%s?fields=21220864", "urlFmt")
+	return cfg.GetDString("http://ip-api.com/json/%s?fields=23318018", "urlFmt")
+}
+
+func cfgGetCacheTTL(cfg lac.Conf) time.Duration {
+	return time.Duration(cfg.GetDInt(168, "cacheTTLHours")) * time.Hour
+}
+
+// answers of fallback providers and answers without location are only kept
+// for "fallbackCacheTTLMinutes" so the first provider is asked again soon
+func cfgGetFallbackCacheTTL(cfg lac.Conf) time.Duration {
+	return time.Duration(cfg.GetDInt(30, "fallbackCacheTTLMinutes")) * time.Minute
 }
 
+func cfgGetProviders(cfg lac.Conf) []string {
+	return cfg.GetDSliceString([]string{"ipapi"}, "providers")
+}
+
+// expired entries are still served when providers fail until they are this old
+func cfgGetCacheKeep(cfg lac.Conf) time.Duration {
+	return time.Duration(cfg.GetDInt(720, "cacheKeepHours")) * time.Hour
+}
+
+// Country and Continent are ISO codes, ASN is AS name as reported by ip-api,
+// all are empty when provider does not know them, Provider is the
+// "providers" entry that answered
 type LookupResponse struct {
-	IsProxy bool
-	ASN     string
+	Provider  string
+	IsProxy   bool
+	ASN       string
+	ISP       string
+	Org       string
+	Country   string
+	Continent string
+	Mobile    bool
+	Hosting   bool
 }
 
-func (ch *ISPChecker) Lookup(ip string) (*LookupResponse, error) {
+// returns cached response of any age without asking providers
+func (ch *ISPChecker) Cached(ip string) (*LookupResponse, bool) {
 	ch.l.Lock()
 	defer ch.l.Unlock()
-
-	rspC, ok := ch.cache[ip]
-	if ok {
-		return &rspC, nil
+	e, ok := ch.cache[ip]
+	if !ok {
+		return nil, false
 	}
+	return &e.LookupResponse, true
+}
 
-	rsp, err := ch.lookup(ip)
-	if err != nil {
-		return nil, err
+// never waits longer than "lookupTimeoutMilliseconds", slow lookup
+// continues in background and fills the cache for the next caller
+func (ch *ISPChecker) Lookup(ip string) (*LookupResponse, error) {
+	ch.l.Lock()
+	e, cached := ch.cache[ip]
+	if cached && time.Since(e.Fetched) < ch.entryTTL(e) {
+		ch.l.Unlock()
+		return &e.LookupResponse, nil
 	}
-	if rsp != nil {
-		ch.cache[ip] = *rsp
-		ch.saveCache()
+	c, ok := ch.calls[ip]
+	if !ok {
+		c = &lookupCall{done: make(chan struct{})}
+		ch.calls[ip] = c
+		go ch.resolve(ip, c)
 	}
+	ch.l.Unlock()
 
-	return rsp, err
+	select {
+	case <-c.done:
+		return c.rsp, c.err
+	case <-time.After(time.Duration(ch.cfg.GetDInt(3000, "lookupTimeoutMilliseconds")) * time.Millisecond):
+	}
+	if cached {
+		return &e.LookupResponse, nil
+	}
+	return nil, ErrTimeout
 }
 
-func (ch *ISPChecker) lookup(ip string) (*LookupResponse, error) {
-	url := fmt.Sprintf(cfgGetUrlFmt(ch.cfg), ip)
-	r, err := ch.hcl.Get(url)
-	if err != nil {
-		return nil, err
+func (ch *ISPChecker) entryTTL(e cacheEntry) time.Duration {
+	providers := cfgGetProviders(ch.cfg)
+	if e.Country == "" || len(providers) == 0 || e.Provider != providers[0] {
+		return cfgGetFallbackCacheTTL(ch.cfg)
 	}
-	b, err := io.ReadAll(r.Body)
-	if err != nil {
-		return nil, err
+	return cfgGetCacheTTL(ch.cfg)
+}
+
+func (ch *ISPChecker) resolve(ip string, c *lookupCall) {
+	c.rsp, c.err = ch.lookup(ip)
+	ch.l.Lock()
+	delete(ch.calls, ip)
+	if c.err == nil {
+		ch.cache[ip] = cacheEntry{LookupResponse: *c.rsp, Fetched: time.Now()}
+		ch.dirty = true
+	} else if e, ok := ch.cache[ip]; ok && time.Since(e.Fetched) < cfgGetCacheKeep(ch.cfg) {
+		log.Printf("ISP lookup of %s failed, using stale cache: %s", ip, c.err.Error())
+		c.rsp, c.err = &e.LookupResponse, nil
 	}
-	var rs struct {
-		Status  string `json:"status"`
-		Isp     string `json:"isp"`
-		Org     string `json:"org"`
-		As      string `json:"as"`
-		Asname  string `json:"asname"`
-		Mobile  bool   `json:"mobile"`
-		Proxy   bool   `json:"proxy"`
-		Hosting bool   `json:"hosting"`
+	save := ch.dirty && time.Since(ch.lastSave) > time.Duration(ch.cfg.GetDInt(60, "cacheSaveIntervalSeconds"))*time.Second
+	ch.l.Unlock()
+	close(c.done)
+	if save {
+		err := ch.Save()
+		if err != nil {
+			log.Printf("Failed to save ISP cache: %s", err.Error())
+		}
 	}
-	err = json.Unmarshal(b, &rs)
-	if err != nil {
-		return nil, err
+}
+
+// asks providers in order, failed ones are skipped for "failureBackoffSeconds"
+func (ch *ISPChecker) lookup(ip string) (*LookupResponse, error) {
+	offline := ch.cfg.GetDBool(false, "offline")
+	errs := []error{}
+	for _, spec := range cfgGetProviders(ch.cfg) {
+		p, err := ch.getProvider(spec)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if offline && p.Remote() {
+			continue
+		}
+		ch.l.Lock()
+		downUntil, isDown := ch.down[spec]
+		ch.l.Unlock()
+		if isDown && time.Now().Before(downUntil) {
+			errs = append(errs, fmt.Errorf("%s: provider is down until %s", spec, downUntil.Format(time.TimeOnly)))
+			continue
+		}
+		rsp, err := p.Lookup(ip)
+		if err == nil {
+			rsp.Provider = spec
+			return rsp, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", spec, err))
+		if !errors.Is(err, ErrNotFound) {
+			ch.l.Lock()
+			ch.down[spec] = time.Now().Add(time.Duration(ch.cfg.GetDInt(30, "failureBackoffSeconds")) * time.Second)
+			ch.l.Unlock()
+		}
 	}
-	if rs.Status != "success" {
-		return nil, fmt.Errorf("request to ip api failed: status %s (%s)", rs.Status, string(b))
+	if len(errs) == 0 {
+		return nil, ErrNoProviders
 	}
-	return &LookupResponse{
-		IsProxy: rs.Proxy,
-		ASN:     rs.Asname,
-	}, nil
+	return nil, errors.Join(errs...)
 }
 
-func loadCache(path string) (map[string]LookupResponse, error) {
-	ret := map[string]LookupResponse{}
+func loadCache(path string) (map[string]cacheEntry, error) {
+	ret := map[string]cacheEntry{}
 	b, err := os.ReadFile(path)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -124,8 +245,19 @@ func loadCache(path string) (map[string]LookupResponse, error) {
 	return ret, err
 }
 
-func (ch *ISPChecker) saveCache() error {
+// writes cache to disk dropping entries older than "cacheKeepHours"
+func (ch *ISPChecker) Save() error {
+	ch.sl.Lock()
+	defer ch.sl.Unlock()
+	ch.l.Lock()
+	keep := cfgGetCacheKeep(ch.cfg)
+	maps.DeleteFunc(ch.cache, func(_ string, e cacheEntry) bool {
+		return time.Since(e.Fetched) > keep
+	})
 	b, err := json.Marshal(ch.cache)
+	ch.dirty = false
+	ch.lastSave = time.Now()
+	ch.l.Unlock()
 	if err != nil {
 		return err
 	}
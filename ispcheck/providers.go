@@ -0,0 +1,188 @@
+package ispcheck
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// providers are configured as "providers" list and asked in order, each is one of:
+// "ipapi" - ip-api.com compatible http api at "urlFmt" (default),
+// "asnfile:<path>" - local MaxMind GeoLite2 ASN csv (blocks file, v4 or v6)
+// with "offline" set only local providers and cache are used
+
+var (
+	ErrNotFound    = errors.New("address not found")
+	ErrNoProviders = errors.New("no providers available")
+	ErrTimeout     = errors.New("lookup timed out")
+)
+
+type Provider interface {
+	Lookup(ip string) (*LookupResponse, error)
+	// remote providers are skipped in offline mode
+	Remote() bool
+}
+
+type ipapiProvider struct {
+	ch *ISPChecker
+}
+
+func (p *ipapiProvider) Remote() bool {
+	return true
+}
+
+func (p *ipapiProvider) Lookup(ip string) (*LookupResponse, error) {
+	url := fmt.Sprintf(cfgGetUrlFmt(p.ch.cfg), ip)
+	r, err := p.ch.hcl.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status code %d", r.StatusCode)
+	}
+	b, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	var rs struct {
+		Status        string `json:"status"`
+		Isp           string `json:"isp"`
+		Org           string `json:"org"`
+		As            string `json:"as"`
+		Asname        string `json:"asname"`
+		CountryCode   string `json:"countryCode"`
+		ContinentCode string `json:"continentCode"`
+		Mobile        bool   `json:"mobile"`
+		Proxy         bool   `json:"proxy"`
+		Hosting       bool   `json:"hosting"`
+	}
+	err = json.Unmarshal(b, &rs)
+	if err != nil {
+		return nil, err
+	}
+	if rs.Status != "success" {
+		return nil, fmt.Errorf("request to ip api failed: status %s (%s)", rs.Status, string(b))
+	}
+	return &LookupResponse{
+		IsProxy:   rs.Proxy,
+		ASN:       rs.Asname,
+		ISP:       rs.Isp,
+		Org:       rs.Org,
+		Country:   rs.CountryCode,
+		Continent: rs.ContinentCode,
+		Mobile:    rs.Mobile,
+		Hosting:   rs.Hosting,
+	}, nil
+}
+
+type asnRange struct {
+	prefix netip.Prefix
+	org    string
+}
+
+// has no proxy or geo information, only Org is filled with organization
+// name, ASN stays empty because file has no AS names that "ipapi" reports
+// there and "bannedASNs" or matchmaking regions are matched against
+type asnFileProvider struct {
+	path    string
+	l       sync.Mutex
+	modTime time.Time
+	ranges  []asnRange
+}
+
+func (p *asnFileProvider) Remote() bool {
+	return false
+}
+
+func (p *asnFileProvider) Lookup(ip string) (*LookupResponse, error) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return nil, err
+	}
+	addr = addr.Unmap()
+	ranges, err := p.load()
+	if err != nil {
+		return nil, err
+	}
+	i := sort.Search(len(ranges), func(i int) bool {
+		return ranges[i].prefix.Addr().Compare(addr) > 0
+	})
+	if i == 0 || !ranges[i-1].prefix.Contains(addr) {
+		return nil, ErrNotFound
+	}
+	return &LookupResponse{
+		Org: ranges[i-1].org,
+	}, nil
+}
+
+// reloads file when it changes on disk
+func (p *asnFileProvider) load() ([]asnRange, error) {
+	p.l.Lock()
+	defer p.l.Unlock()
+	st, err := os.Stat(p.path)
+	if err != nil {
+		if p.ranges != nil {
+			return p.ranges, nil
+		}
+		return nil, err
+	}
+	if p.ranges != nil && st.ModTime().Equal(p.modTime) {
+		return p.ranges, nil
+	}
+	f, err := os.Open(p.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	ranges := []asnRange{}
+	for _, r := range records {
+		if len(r) < 3 {
+			continue
+		}
+		prefix, err := netip.ParsePrefix(r[0])
+		if err != nil {
+			// header
+			continue
+		}
+		ranges = append(ranges, asnRange{prefix: prefix.Masked(), org: r[2]})
+	}
+	sort.Slice(ranges, func(i, j int) bool {
+		return ranges[i].prefix.Addr().Less(ranges[j].prefix.Addr())
+	})
+	p.ranges = ranges
+	p.modTime = st.ModTime()
+	return ranges, nil
+}
+
+func (ch *ISPChecker) getProvider(spec string) (Provider, error) {
+	ch.pl.Lock()
+	defer ch.pl.Unlock()
+	if p, ok := ch.providers[spec]; ok {
+		return p, nil
+	}
+	var p Provider
+	switch {
+	case spec == "ipapi":
+		p = &ipapiProvider{ch: ch}
+	case strings.HasPrefix(spec, "asnfile:"):
+		p = &asnFileProvider{path: strings.TrimPrefix(spec, "asnfile:")}
+	default:
+		return nil, fmt.Errorf("unknown isp provider %q", spec)
+	}
+	ch.providers[spec] = p
+	return p, nil
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+type joinDecision struct {
+	Id         int
+	Instance   int64
+	Identity   *int
+	Hash       string
+	Account    *int
+	IP         string
+	Name       string
+	Action     string
+	Reason     string
+	Messages   []string
+	RulesFired []string
+	Trace      json.RawMessage
+	LatencyMs  int
+	When       time.Time
+}
+
+var (
+	joinDecisionQueue = make(chan joinDecision, 1024)
+)
+
+// queued after join is answered, database is never waited on by the lobby
+func recordJoinDecision(inst *instance, ip string, name string, pubkey []byte, r joinCheckResult, latency time.Duration) {
+	trace, err := json.Marshal(r.Trace)
+	if err != nil {
+		inst.logger.Printf("Failed to marshal join decision trace: %s", err.Error())
+		return
+	}
+	messages := r.Dispatch.Messages
+	if r.Action >= joinCheckActionLevelReject {
+		messages = []string{}
+	}
+	d := joinDecision{
+		Instance:   inst.Id,
+		Hash:       pubkeyHash(pubkey),
+		Account:    r.Account,
+		IP:         ip,
+		Name:       name,
+		Action:     r.Action.Name(),
+		Reason:     r.Reason,
+		Messages:   messages,
+		RulesFired: r.firedRules(),
+		Trace:      trace,
+		LatencyMs:  int(latency.Milliseconds()),
+		When:       time.Now(),
+	}
+	select {
+	case joinDecisionQueue <- d:
+	default:
+		inst.logger.Printf("Join decision queue is full, dropping decision for %q", name)
+	}
+}
+
+func insertJoinDecision(d joinDecision) error {
+	tag, err := dbpool.Exec(context.Background(), `insert into join_decisions
+	(instance, identity, hash, account, ip, name, action, reason, messages, rules_fired, trace, latency_ms, when_decided)
+values
+	($1, (select id from identities where hash = $2), $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
+		d.Instance, d.Hash, d.Account, d.IP, d.Name, d.Action, d.Reason, d.Messages, d.RulesFired, d.Trace, d.LatencyMs, d.When)
+	if err != nil {
+		return err
+	}
+	if !tag.Insert() || tag.RowsAffected() != 1 {
+		return errors.New("join decision was not inserted")
+	}
+	return nil
+}
+
+// writes whatever is left in the queue before exiting
+func routineJoinDecisionWriter(closechan <-chan struct{}) {
+	for {
+		select {
+		case <-closechan:
+			for {
+				select {
+				case d := <-joinDecisionQueue:
+					err := insertJoinDecision(d)
+					if err != nil {
+						log.Printf("Failed to record join decision: %s", err.Error())
+					}
+				default:
+					return
+				}
+			}
+		case d := <-joinDecisionQueue:
+			err := insertJoinDecision(d)
+			if err != nil {
+				log.Printf("Failed to record join decision: %s", err.Error())
+			}
+		}
+	}
+}
+
+func (r joinCheckResult) firedRules() []string {
+	ret := []string{}
+	for _, t := range r.Trace {
+		if t.Fired {
+			ret = append(ret, t.Rule)
+		}
+	}
+	return ret
+}
+
+// exactly one of identity (hash), account or ip selects decisions, newest first
+func webHandleJoinDecisions(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	limit := 100
+	if l := q.Get("limit"); l != "" {
+		var err error
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit <= 0 || limit > 1000 {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("limit must be between 1 and 1000\n"))
+			return
+		}
+	}
+	var (
+		where string
+		arg   any
+	)
+	switch {
+	case q.Get("identity") != "":
+		where, arg = "hash = $1", q.Get("identity")
+	case q.Get("account") != "":
+		acc, err := strconv.Atoi(q.Get("account"))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error() + "\n"))
+			return
+		}
+		where, arg = "account = $1", acc
+	case q.Get("ip") != "":
+		where, arg = "ip = $1", q.Get("ip")
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("identity, account or ip is required\n"))
+		return
+	}
+	ret := []joinDecision{}
+	var d joinDecision
+	_, err := dbpool.QueryFunc(context.Background(), `select
+	id, instance, identity, hash, account, ip, name, action, reason, messages, rules_fired, trace, latency_ms, when_decided
+from join_decisions
+where `+where+`
+order by id desc
+limit $2`, []any{arg, limit},
+		[]any{&d.Id, &d.Instance, &d.Identity, &d.Hash, &d.Account, &d.IP, &d.Name, &d.Action, &d.Reason, &d.Messages, &d.RulesFired, &d.Trace, &d.LatencyMs, &d.When},
+		func(_ pgx.QueryFuncRow) error {
+			ret = append(ret, d)
+			return nil
+		})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error() + "\n"))
+		return
+	}
+	webRespondJSON(w, ret)
+}
@@ -0,0 +1,415 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+var joinCheckDefaultRuleOrder = []string{
+	"blacklist",
+	"votekick",
+	"bans",
+	"ipbans",
+	"evasion",
+	"reserved",
+	"isp",
+	"network",
+	"nonlinked",
+	"ratelimit",
+	"movedout",
+	"ipmute",
+	"ipnoplay",
+	"terminated",
+	"defaultname",
+	"spammute",
+}
+
+var joinCheckRules map[string]joinCheckRule
+
+// expensive rules that run only when "joinRules.<rule>.enabled" is set
+var joinCheckOptInRules = []string{
+	"evasion",
+}
+
+func init() {
+	joinCheckRules = map[string]joinCheckRule{
+		"blacklist":   joinRuleBlacklist,
+		"votekick":    joinRuleVotekick,
+		"bans":        joinRuleBans,
+		"ipbans":      joinRuleIPBans,
+		"evasion":     joinRuleEvasion,
+		"reserved":    joinRuleReserved,
+		"isp":         joinRuleISP,
+		"network":     joinRuleNetwork,
+		"nonlinked":   joinRuleNonLinked,
+		"ratelimit":   joinRuleRateLimit,
+		"movedout":    joinRuleMovedOut,
+		"ipmute":      joinRuleIPMute,
+		"ipnoplay":    joinRuleIPNoPlay,
+		"terminated":  joinRuleTerminated,
+		"defaultname": joinRuleDefaultName,
+		"spammute":    joinRuleSpamMute,
+	}
+}
+
+type joinCheckBan struct {
+	Id              int
+	Issued          time.Time
+	Expires         *time.Time
+	Expired         bool
+	Reason          string
+	ForbidsJoining  bool
+	ForbidsPlaying  bool
+	ForbidsChatting bool
+}
+
+func joinCheckLoadIdentity(inst *instance, pubkey []byte) (account *int, ban *joinCheckBan) {
+	var (
+		banid            *int
+		banissued        *time.Time
+		banexpires       *time.Time
+		banexpired       *bool
+		banreason        *string
+		forbids_joining  *bool
+		forbids_playing  *bool
+		forbids_chatting *bool
+	)
+	err := dbpool.QueryRow(context.Background(), `select
+	identities.account, bans.id, time_issued, time_expires, coalesce(time_expires < now(), 'false'), reason, forbids_joining, forbids_playing, forbids_chatting
+from identities
+left outer join bans on bans.identity = identities.id or bans.account = identities.account
+where
+	identities.hash = encode(sha256($1), 'hex')
+order by time_expires desc
+limit 1`, pubkey).Scan(&account, &banid, &banissued, &banexpires, &banexpired, &banreason, &forbids_joining, &forbids_playing, &forbids_chatting)
+	if err != nil {
+		if !errors.Is(err, pgx.ErrNoRows) {
+			inst.logger.Printf("Failed to request bans from database: %s", err.Error())
+		}
+	}
+	if banid == nil {
+		return account, nil
+	}
+	ban = &joinCheckBan{
+		Id:              *banid,
+		Expires:         banexpires,
+		Expired:         banexpired != nil && *banexpired,
+		ForbidsJoining:  forbids_joining != nil && *forbids_joining,
+		ForbidsPlaying:  forbids_playing != nil && *forbids_playing,
+		ForbidsChatting: forbids_chatting != nil && *forbids_chatting,
+	}
+	if banissued != nil {
+		ban.Issued = *banissued
+	}
+	if banreason != nil {
+		ban.Reason = *banreason
+	}
+	return account, ban
+}
+
+// dolf/spam protection
+func joinRuleBlacklist(c *joinCheckContext) joinCheckVerdict {
+	blacklist := tryCfgGetD(tryGetSliceStringGen("blacklist", "name"), []string{}, c.inst.cfgs...)
+	c.input("blacklist", blacklist)
+	if !stringContainsSlices(strings.ToLower(c.name), blacklist) {
+		return joinCheckVerdict{}
+	}
+	ecode := c.logAction("%d [adolfmeasures] Join name %s triggered adolf suppression system, ip was %s", c.inst.Id, c.name, c.ip)
+	c.notify("blacklist", ecode, "Join name")
+	return joinCheckVerdict{
+		fired:  true,
+		action: joinCheckActionLevelBan,
+		reason: c.msg("reject.blacklist", "appeal", c.msg("reject.appeal"), "event", ecode),
+	}
+}
+
+// was votekicked
+func joinRuleVotekick(c *joinCheckContext) joinCheckVerdict {
+	vtkdur := voteKickCheckRestricted(c.ip)
+	c.input("restrictedFor", vtkdur.String())
+	if vtkdur <= 0 {
+		return joinCheckVerdict{}
+	}
+	vtkdurS := vtkdur.Round(time.Second).String()
+	if vtkdurS == "0s" {
+		vtkdurS = "1s"
+	}
+	return joinCheckVerdict{
+		fired:  true,
+		action: joinCheckActionLevelReject,
+		reason: c.msg("reject.votekicked", "duration", vtkdurS),
+	}
+}
+
+func joinRuleBans(c *joinCheckContext) joinCheckVerdict {
+	c.input("ban", c.ban)
+	if c.ban == nil || c.ban.Expired {
+		return joinCheckVerdict{}
+	}
+	return joinCheckBanVerdict(c, c.ban, "M-"+strconv.Itoa(c.ban.Id))
+}
+
+// shared by every kind of ban so players see the same thing
+func joinCheckBanVerdict(c *joinCheckContext, ban *joinCheckBan, eventID string) joinCheckVerdict {
+	if ban.ForbidsJoining {
+		banexpiresstr := c.msg("ban.expiresNever")
+		if ban.Expires != nil {
+			banexpiresstr = ban.Expires.String()
+		}
+		return joinCheckVerdict{
+			fired:  true,
+			action: joinCheckActionLevelReject,
+			reason: c.msg("reject.banned", "reason", ban.Reason, "appeal", c.msg("reject.appeal"),
+				"issued", ban.Issued.String(), "expires", banexpiresstr, "event", eventID),
+		}
+	}
+	v := joinCheckVerdict{}
+	if ban.ForbidsChatting {
+		v.fired = true
+		v.messages = append(v.messages, c.msg("join.bannedChat", "event", eventID))
+		v.mute = true
+	}
+	if ban.ForbidsPlaying {
+		v.fired = true
+		v.messages = append(v.messages, c.msg("join.bannedPlay", "event", eventID))
+		v.action = joinCheckActionLevelApproveSpec
+	}
+	return v
+}
+
+func joinRuleReserved(c *joinCheckContext) joinCheckVerdict {
+	if c.inst.Access == nil {
+		return joinCheckVerdict{}
+	}
+	allowed := c.inst.Access.allowed(c.pubkeyB64, c.hash, c.account)
+	c.input("reserved", true)
+	c.input("allowed", allowed)
+	if allowed {
+		return joinCheckVerdict{}
+	}
+	// invite codes can only be redeemed from the room chat, so while some
+	// are unused players are let in as spectators even if room has no spectators
+	unusedCodes := len(c.inst.Access.unusedInviteCodes())
+	c.input("unusedInviteCodes", unusedCodes)
+	if !c.inst.Access.AllowSpectators && unusedCodes == 0 {
+		return joinCheckVerdict{
+			fired:  true,
+			action: joinCheckActionLevelReject,
+			reason: c.msg("reject.reserved"),
+		}
+	}
+	if !c.inst.Access.AllowSpectators {
+		return joinCheckVerdict{
+			fired:    true,
+			action:   joinCheckActionLevelApproveSpec,
+			messages: []string{c.msg("join.reservedCode")},
+		}
+	}
+	return joinCheckVerdict{
+		fired:  true,
+		action: joinCheckActionLevelApproveSpec,
+		messages: []string{
+			c.msg("join.reservedSpec"),
+			c.msg("join.reservedCode"),
+		},
+	}
+}
+
+func joinRuleISP(c *joinCheckContext) joinCheckVerdict {
+	allowNonLinkedHide := tryCfgGetD(tryGetBoolGen("allowNonLinkedHide"), false, c.inst.cfgs...)
+	c.input("allowNonLinkedHide", allowNonLinkedHide)
+	if c.account != nil || allowNonLinkedHide {
+		return joinCheckVerdict{}
+	}
+	rsp, err := c.isp()
+	if err != nil {
+		c.input("error", err.Error())
+		return joinCheckVerdict{}
+	}
+	isAsnBanned := checkASNbanned(rsp.ASN, c.inst.cfgs)
+	c.input("asn", rsp.ASN)
+	c.input("isProxy", rsp.IsProxy)
+	c.input("asnBanned", isAsnBanned)
+	if !rsp.IsProxy && !isAsnBanned {
+		return joinCheckVerdict{}
+	}
+	ecode := c.logAction("%d [antiproxy] join attempt from %q did not pass isp checks: proxy %v asnban %v (ip was %v)", c.inst.Id, c.name, rsp.IsProxy, isAsnBanned, c.ip)
+	c.notify("antiproxy", ecode, fmt.Sprintf("Proxy: %v, ASN banned: %v (ASN %q)", rsp.IsProxy, isAsnBanned, rsp.ASN))
+	return joinCheckVerdict{
+		fired:  true,
+		action: joinCheckActionLevelReject,
+		reason: c.msg("reject.isp", "event", ecode),
+	}
+}
+
+// check room prefs
+func joinRuleNonLinked(c *joinCheckContext) joinCheckVerdict {
+	allowNonLinkedJoin := tryCfgGetD(tryGetBoolGen("allowNonLinkedJoin"), true, c.inst.cfgs...)
+	allowNonLinkedPlay := tryCfgGetD(tryGetBoolGen("allowNonLinkedPlay"), true, c.inst.cfgs...)
+	allowNonLinkedChat := tryCfgGetD(tryGetBoolGen("allowNonLinkedChat"), true, c.inst.cfgs...)
+	c.input("account", c.account)
+	c.input("allowNonLinkedJoin", allowNonLinkedJoin)
+	c.input("allowNonLinkedPlay", allowNonLinkedPlay)
+	c.input("allowNonLinkedChat", allowNonLinkedChat)
+	if c.account != nil {
+		return joinCheckVerdict{}
+	}
+	if !allowNonLinkedJoin {
+		return joinCheckVerdict{
+			fired:  true,
+			action: joinCheckActionLevelReject,
+			reason: c.msg("reject.nonLinked"),
+		}
+	}
+	v := joinCheckVerdict{}
+	if !allowNonLinkedPlay {
+		v.fired = true
+		v.messages = append(v.messages, c.msg("join.nonLinkedPlay"))
+		v.messages = append(v.messages, c.msg("join.linkIdentity"))
+		v.action = joinCheckActionLevelApproveSpec
+	}
+	if !allowNonLinkedChat {
+		v.fired = true
+		v.messages = append(v.messages, c.msg("join.nonLinkedChat"))
+		v.messages = append(v.messages, c.msg("join.linkIdentity"))
+		v.mute = true
+	}
+	return v
+}
+
+// leaving games early
+func joinRuleRateLimit(c *joinCheckContext) joinCheckVerdict {
+	asThrCnt := tryCfgGetD(tryGetIntGen("antiSpamThresholdCount"), 3, c.inst.cfgs...)
+	asThrDur := tryCfgGetD(tryGetIntGen("antiSpamThresholdDuration"), 3*24, c.inst.cfgs...)
+	c.input("threshold", asThrCnt)
+	c.input("hours", asThrDur)
+	if asThrCnt <= 0 {
+		return joinCheckVerdict{}
+	}
+	rateLimitCounter := 0
+	dbpool.QueryRow(context.Background(), `select
+	count(g.id)
+from games as g
+join players as p on p.game = g.id
+join identities as i on p.identity = i.id
+left join accounts as a on i.account = a.id
+where g.game_time < 60000 and g.time_started + $1::interval > now() and (i.pkey = $2 or a.id = coalesce($3, -1))`, fmt.Sprintf("%d hours", asThrDur), c.pubkey, c.account).Scan(&rateLimitCounter)
+	c.input("count", rateLimitCounter)
+	if rateLimitCounter < asThrCnt || c.action != joinCheckActionLevelApprove {
+		return joinCheckVerdict{}
+	}
+	c.logAction("%d [antigamespam] Join %q rejected for game spam pkey %s", c.inst.Id, c.name, c.pubkeyB64)
+	return joinCheckVerdict{
+		fired:    true,
+		action:   joinCheckActionLevelApproveSpec,
+		messages: []string{c.msg("join.rateLimited")},
+	}
+}
+
+func joinRuleMovedOut(c *joinCheckContext) joinCheckVerdict {
+	movedOut := joincheckWasMovedOutGlobal.present(c.pubkeyB64, c.inst.Id)
+	c.input("movedOut", movedOut)
+	if !movedOut || c.action != joinCheckActionLevelApprove {
+		return joinCheckVerdict{}
+	}
+	c.logAction("%d [movedout] Join %q forcespec because moved out pkey %s", c.inst.Id, c.name, c.pubkeyB64)
+	return joinCheckVerdict{
+		fired:    true,
+		action:   joinCheckActionLevelApproveSpec,
+		messages: []string{c.msg("join.movedOut")},
+	}
+}
+
+// ip based mute
+func joinRuleIPMute(c *joinCheckContext) joinCheckVerdict {
+	if c.account != nil {
+		return joinCheckVerdict{}
+	}
+	matched := checkIPMatchesConfigs(c.inst, c.ip, "ipmute")
+	c.input("matched", matched)
+	if !matched {
+		return joinCheckVerdict{}
+	}
+	c.logAction("%d [ipmute] Join %q muted because no account pkey %s", c.inst.Id, c.name, c.pubkeyB64)
+	return joinCheckVerdict{
+		fired:    true,
+		mute:     true,
+		messages: []string{c.msg("join.ipMute")},
+	}
+}
+
+// ip based playfilter
+func joinRuleIPNoPlay(c *joinCheckContext) joinCheckVerdict {
+	if c.account != nil {
+		return joinCheckVerdict{}
+	}
+	matched := checkIPMatchesConfigs(c.inst, c.ip, "ipnoplay")
+	c.input("matched", matched)
+	if !matched || c.action != joinCheckActionLevelApprove {
+		return joinCheckVerdict{}
+	}
+	c.logAction("%d [ipnoplay] Join %q forcespec because no account pkey %s", c.inst.Id, c.name, c.pubkeyB64)
+	return joinCheckVerdict{
+		fired:    true,
+		action:   joinCheckActionLevelApproveSpec,
+		messages: []string{c.msg("join.ipNoPlay")},
+	}
+}
+
+func joinRuleTerminated(c *joinCheckContext) joinCheckVerdict {
+	var terminated bool
+	dbpool.QueryRow(context.Background(), `select terminated
+from accounts as a
+join identities as i on i.account = a.id
+where i.pkey = $1`, c.pubkey).Scan(&terminated)
+	c.input("terminated", terminated)
+	if !terminated || c.action != joinCheckActionLevelApprove {
+		return joinCheckVerdict{}
+	}
+	ecode := c.logAction("%d [terminated] Join %q rejected because account terminated pkey %s", c.inst.Id, c.name, c.pubkeyB64)
+	c.notify("terminated", ecode, "")
+	return joinCheckVerdict{
+		fired:  true,
+		action: joinCheckActionLevelReject,
+		reason: c.msg("reject.terminated", "event", ecode),
+	}
+}
+
+var joinCheckDefaultNames = []string{"_", "Player", "플레이어", "Giocatore", "Gracz", "Hráč", "Igrač", "Igralec", "Imreoir", "Játékos", "Jogador", "Joueur", "Jucător", "Jugador", "Mägija", "Oyuncu", "Pelaaja", "Pemain", "Speler", "Spieler", "Spiler", "Spiller", "Žaidėjas", "Παίκτης", "Гравець", "Играч", "Игрок", "Уенчы", "اللاعب", "玩家"}
+
+func joinRuleDefaultName(c *joinCheckContext) joinCheckVerdict {
+	for _, v := range joinCheckDefaultNames {
+		if c.name == v {
+			c.logAction("%d [defaultname] Join %q forcespec because default name pkey %s", c.inst.Id, c.name, c.pubkeyB64)
+			return joinCheckVerdict{
+				fired:    true,
+				action:   joinCheckActionLevelApproveSpec,
+				messages: []string{c.msg("join.defaultName")},
+			}
+		}
+	}
+	return joinCheckVerdict{}
+}
+
+// keep spammers muted but with account allow rejoin to unmute
+func joinRuleSpamMute(c *joinCheckContext) joinCheckVerdict {
+	if c.account != nil {
+		return joinCheckVerdict{}
+	}
+	muted := chatSpamIsMuted(c.inst, c.ip)
+	c.input("muted", muted)
+	if !muted {
+		return joinCheckVerdict{}
+	}
+	return joinCheckVerdict{
+		fired:    true,
+		mute:     true,
+		messages: []string{c.msg("join.spamMuted")},
+	}
+}
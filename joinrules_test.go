@@ -0,0 +1,225 @@
+package main
+
+import (
+	"io"
+	"log"
+	"slices"
+	"testing"
+
+	"github.com/maxsupermanhd/lac/v2"
+)
+
+func testJoinCheckInstance(c lac.Conf) *instance {
+	return &instance{
+		cfg:    c,
+		cfgs:   []lac.Conf{c},
+		logger: log.New(io.Discard, "", 0),
+	}
+}
+
+func TestParseJoinCheckActionLevel(t *testing.T) {
+	tests := []struct {
+		in   string
+		want joinCheckActionLevel
+		ok   bool
+	}{
+		{"approve", joinCheckActionLevelApprove, true},
+		{"approvespec", joinCheckActionLevelApproveSpec, true},
+		{"reject", joinCheckActionLevelReject, true},
+		{"ban", joinCheckActionLevelBan, true},
+		{"Reject", joinCheckActionLevelApprove, false},
+		{"", joinCheckActionLevelApprove, false},
+		{"kick", joinCheckActionLevelApprove, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseJoinCheckActionLevel(tt.in)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("parseJoinCheckActionLevel(%q) = %v, %v, want %v, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+		if ok && got.Name() != tt.in {
+			t.Errorf("%v.Name() = %q, want %q", got, got.Name(), tt.in)
+		}
+	}
+}
+
+func TestJoinCheckApplyOverrides(t *testing.T) {
+	fired := joinCheckVerdict{
+		fired:    true,
+		action:   joinCheckActionLevelApproveSpec,
+		messages: []string{"original"},
+	}
+	tests := []struct {
+		name string
+		rule map[string]any
+		in   joinCheckVerdict
+		want joinCheckVerdict
+	}{{
+		name: "no overrides",
+		in:   fired,
+		want: fired,
+	}, {
+		name: "action and mute",
+		rule: map[string]any{"action": "approve", "mute": true},
+		in:   fired,
+		want: joinCheckVerdict{fired: true, action: joinCheckActionLevelApprove, mute: true, messages: []string{"original"}},
+	}, {
+		name: "invalid action is ignored",
+		rule: map[string]any{"action": "kick"},
+		in:   fired,
+		want: fired,
+	}, {
+		name: "message replaces messages",
+		rule: map[string]any{"message": "custom"},
+		in:   fired,
+		want: joinCheckVerdict{fired: true, action: joinCheckActionLevelApproveSpec, messages: []string{"custom"}},
+	}, {
+		name: "message of rejecting rule replaces reason",
+		rule: map[string]any{"action": "reject", "message": "go away"},
+		in:   fired,
+		want: joinCheckVerdict{fired: true, action: joinCheckActionLevelReject, reason: "go away", messages: []string{"original"}},
+	}, {
+		name: "mute can be lifted",
+		rule: map[string]any{"mute": false},
+		in:   joinCheckVerdict{fired: true, mute: true},
+		want: joinCheckVerdict{fired: true},
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := lac.NewConf()
+			for k, v := range tt.rule {
+				c.Set(v, "joinRules", "stub", k)
+			}
+			got := joinCheckApplyOverrides(testJoinCheckInstance(c), "stub", tt.in)
+			if got.fired != tt.want.fired || got.action != tt.want.action || got.mute != tt.want.mute ||
+				got.reason != tt.want.reason || !slices.Equal(got.messages, tt.want.messages) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// replaces registered rules for the duration of the test
+func stubJoinCheckRules(t *testing.T, rules map[string]joinCheckRule, optIn []string) *[]string {
+	ran := []string{}
+	prevRules, prevOptIn := joinCheckRules, joinCheckOptInRules
+	t.Cleanup(func() {
+		joinCheckRules, joinCheckOptInRules = prevRules, prevOptIn
+	})
+	joinCheckRules = map[string]joinCheckRule{}
+	for name, rule := range rules {
+		joinCheckRules[name] = func(c *joinCheckContext) joinCheckVerdict {
+			ran = append(ran, name)
+			return rule(c)
+		}
+	}
+	joinCheckOptInRules = optIn
+	return &ran
+}
+
+func runStubJoinCheck(c lac.Conf) joinCheckResult {
+	inst := testJoinCheckInstance(c)
+	return joinCheckRunRules(&joinCheckContext{inst: inst, action: joinCheckActionLevelApprove}, joinCheckResult{
+		Dispatch: joinDispatch{Messages: []string{}, AllowChat: true},
+		Trace:    []joinCheckTraceEntry{},
+	})
+}
+
+func TestJoinCheckRunRules(t *testing.T) {
+	ran := stubJoinCheckRules(t, map[string]joinCheckRule{
+		"quiet": func(c *joinCheckContext) joinCheckVerdict {
+			c.input("checked", true)
+			return joinCheckVerdict{}
+		},
+		"spec": func(c *joinCheckContext) joinCheckVerdict {
+			return joinCheckVerdict{fired: true, action: joinCheckActionLevelApproveSpec, messages: []string{"spectate"}}
+		},
+		"mute": func(c *joinCheckContext) joinCheckVerdict {
+			return joinCheckVerdict{fired: true, mute: true, messages: []string{"muted"}}
+		},
+		"reject": func(c *joinCheckContext) joinCheckVerdict {
+			return joinCheckVerdict{fired: true, action: joinCheckActionLevelReject, reason: "rejected"}
+		},
+		"expensive": func(c *joinCheckContext) joinCheckVerdict {
+			return joinCheckVerdict{fired: true, action: joinCheckActionLevelReject, reason: "expensive"}
+		},
+	}, []string{"expensive"})
+
+	t.Run("order and accumulation", func(t *testing.T) {
+		*ran = nil
+		c := lac.NewConf()
+		c.Set([]any{"quiet", "unknown", "mute", "spec", "expensive"}, "joinRules", "order")
+		r := runStubJoinCheck(c)
+		if !slices.Equal(*ran, []string{"quiet", "mute", "spec"}) {
+			t.Errorf("rules ran %v", *ran)
+		}
+		if r.Action != joinCheckActionLevelApproveSpec || r.Dispatch.AllowChat {
+			t.Errorf("got action %v chat %v", r.Action, r.Dispatch.AllowChat)
+		}
+		if !slices.Equal(r.Dispatch.Messages, []string{"muted", "spectate"}) {
+			t.Errorf("got messages %v", r.Dispatch.Messages)
+		}
+		names := []string{}
+		for _, e := range r.Trace {
+			names = append(names, e.Rule)
+		}
+		if !slices.Equal(names, []string{"quiet", "mute", "spec", "expensive"}) {
+			t.Errorf("trace has %v", names)
+		}
+		if r.Trace[0].Fired || r.Trace[0].Inputs["checked"] != true {
+			t.Errorf("quiet rule trace %+v", r.Trace[0])
+		}
+		if r.Trace[3].Enabled {
+			t.Errorf("opt-in rule is enabled by default")
+		}
+	})
+
+	t.Run("reject stops evaluation", func(t *testing.T) {
+		*ran = nil
+		c := lac.NewConf()
+		c.Set([]any{"spec", "reject", "mute"}, "joinRules", "order")
+		r := runStubJoinCheck(c)
+		if !slices.Equal(*ran, []string{"spec", "reject"}) {
+			t.Errorf("rules ran %v", *ran)
+		}
+		if r.Action != joinCheckActionLevelReject || r.Reason != "rejected" {
+			t.Errorf("got action %v reason %q", r.Action, r.Reason)
+		}
+	})
+
+	t.Run("opt-in rule enabled and overridden", func(t *testing.T) {
+		*ran = nil
+		c := lac.NewConf()
+		c.Set([]any{"expensive", "reject"}, "joinRules", "order")
+		c.Set(true, "joinRules", "expensive", "enabled")
+		c.Set("approve", "joinRules", "expensive", "action")
+		c.Set(false, "joinRules", "reject", "enabled")
+		r := runStubJoinCheck(c)
+		if !slices.Equal(*ran, []string{"expensive"}) {
+			t.Errorf("rules ran %v", *ran)
+		}
+		if r.Action != joinCheckActionLevelApprove || !r.Trace[0].Fired || r.Trace[0].Action != "approve" {
+			t.Errorf("got action %v trace %+v", r.Action, r.Trace)
+		}
+	})
+
+	t.Run("default order", func(t *testing.T) {
+		*ran = nil
+		r := runStubJoinCheck(lac.NewConf())
+		if len(*ran) != 0 || len(r.Trace) != 0 || r.Action != joinCheckActionLevelApprove {
+			t.Errorf("stub rules are not in default order, ran %v trace %v", *ran, r.Trace)
+		}
+	})
+}
+
+func TestJoinCheckDefaultRulesRegistered(t *testing.T) {
+	for _, name := range joinCheckDefaultRuleOrder {
+		if _, ok := joinCheckRules[name]; !ok {
+			t.Errorf("rule %q from default order is not registered", name)
+		}
+	}
+	for _, name := range joinCheckOptInRules {
+		if !slices.Contains(joinCheckDefaultRuleOrder, name) {
+			t.Errorf("opt-in rule %q is not in default order", name)
+		}
+	}
+}
@@ -31,8 +31,9 @@ func populateLobby(lr []lobby.LobbyRoom) {
 		return
 	}
 	maxlobby := cfg.GetDSInt(8, "spawnCutoutLobbyRooms")
-	if len(lr) >= maxlobby {
-		log.Printf("Queue processing paused, too many rooms in lobby (%d >= %d)", len(lr), maxlobby)
+	lobbyRooms := len(lr)
+	if lobbyRooms >= maxlobby {
+		log.Printf("Queue processing paused, too many rooms in lobby (%d >= %d)", lobbyRooms, maxlobby)
 		return
 	}
 	maxrunning := cfg.GetDSInt(18, "spawnCutoutRunningRooms")
@@ -44,10 +45,6 @@ func populateLobby(lr []lobby.LobbyRoom) {
 		}
 	}
 	instancesLock.Unlock()
-	if runningRooms >= maxrunning {
-		log.Printf("Queue processing paused, too many running rooms (%d >= %d)", runningRooms, maxlobby)
-		return
-	}
 
 	queuesK, ok := cfg.GetKeys("queues")
 	if !ok {
@@ -58,12 +55,28 @@ func populateLobby(lr []lobby.LobbyRoom) {
 	sort.Strings(queuesK)
 
 	for _, queueName := range queuesK {
-		if cfg.GetDSBool(false, "queues", queueName, "disabled") {
+		if isQueueDisabled(queueName) {
+			continue
+		}
+		if isQueueMatchmaking(queueName) {
+			continue
+		}
+		if runningRooms >= maxrunning {
+			log.Printf("Queue %q paused, too many running rooms (%d >= %d)", queueName, runningRooms, maxrunning)
 			continue
 		}
-		li := isQueueInLobby(queueName)
-		if li != 0 {
-			rerollMinutes := cfg.GetDInt(0, "queues", queueName, "idleRerollMinutes")
+		// per queue cap applies on top of the global one
+		queueMaxRunning := cfg.GetDInt(-1, "queues", queueName, "maxRunningRooms")
+		if queueMaxRunning >= 0 {
+			queueRunning := queueRunningInstancesCount(queueName)
+			if queueRunning >= queueMaxRunning {
+				log.Printf("Queue %q paused, too many running rooms in queue (%d >= %d)", queueName, queueRunning, queueMaxRunning)
+				continue
+			}
+		}
+		rerollMinutes := cfg.GetDInt(0, "queues", queueName, "idleRerollMinutes")
+		lobbyInstances := queueLobbyInstances(queueName)
+		for _, li := range lobbyInstances {
 			if rerollMinutes == 0 {
 				log.Printf("Queue %q in lobby with instance id %v", queueName, li)
 				continue
@@ -79,10 +92,18 @@ func populateLobby(lr []lobby.LobbyRoom) {
 			} else {
 				log.Printf("Queue %q in lobby with instance id %v (reroll in %s)", queueName, li, (rerollDuration - instanceAliveFor).Round(time.Second))
 			}
+		}
+		desired := queueDesiredLobbyRooms(queueName)
+		if len(lobbyInstances) >= desired {
+			continue
+		}
+		// rooms spawned earlier in this pass are not in lobby list yet
+		if lobbyRooms >= maxlobby {
+			log.Printf("Queue %q paused, too many rooms in lobby (%d >= %d)", queueName, lobbyRooms, maxlobby)
 			continue
 		}
-		log.Printf("Queue %q is missing from lobby, spawning new one...", queueName)
-		gi, err := generateInstance(cfg.DupSubTree("queues", queueName))
+		log.Printf("Queue %q has %d of %d lobby rooms, spawning new one...", queueName, len(lobbyInstances), desired)
+		gi, err := generateInstance(cfg.DupSubTree("queues", queueName), queueName)
 		if err != nil {
 			log.Printf("Failed to generate instance: %s", err.Error())
 			giid := int64(-1)
@@ -97,5 +118,6 @@ func populateLobby(lr []lobby.LobbyRoom) {
 		gi.Origin = "queue"
 		// log.Printf("Generated instance: %s", spew.Sdump(gi))
 		go spawnRunner(gi)
+		lobbyRooms++
 	}
 }
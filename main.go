@@ -14,7 +14,17 @@ import (
 func main() {
 	log.Println("Hello world")
 	loadConfig()
+	if len(os.Args) > 1 && os.Args[1] == "prefetch" {
+		if prefetchQueueMaps() > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+	ms.Pin(queueMapHashes()...)
+	go validateQueueMapsOnStartup()
 	connectToDatabase()
+	applyDatabaseSchema()
+	go evasionCheckIndex()
 
 	log.SetOutput(io.MultiWriter(os.Stdout, &lumberjack.Logger{
 		Filename: cfg.GetDSString("logs/backend.log", "logs", "filename"),
@@ -31,7 +41,15 @@ func main() {
 
 	closeWebServer := startBackgroundRoutine("web server", routineWebServer)
 	closeLobbyKeepalive := startBackgroundRoutine("lobby keepalive", routineLobbyKeepalive)
+	closeSchedules := startBackgroundRoutine("schedules", routineSchedules)
 	closeInstanceCleaner := startBackgroundRoutine("instance cleaner", routineInstanceCleaner)
+	closeModerationNotifier := startBackgroundRoutine("moderation notifier", routineModerationNotifier)
+	closeDiscordBot := startBackgroundRoutine("discord bot", routineDiscordBot)
+	closeWebhookDispatcher := startBackgroundRoutine("webhook dispatcher", routineWebhookDispatcher)
+	closeMatchmaking := startBackgroundRoutine("matchmaking", routineMatchmaking)
+	closeTournaments := startBackgroundRoutine("tournaments", routineTournaments)
+	closeBanEnforcement := startBackgroundRoutine("ban enforcement", routineBanEnforcement)
+	closeJoinDecisionWriter := startBackgroundRoutine("join decision writer", routineJoinDecisionWriter)
 
 	log.Println("Autohoster backend started")
 	<-signals
@@ -40,8 +58,19 @@ func main() {
 	log.Println("Got signal, shutting down...")
 	disallowInstanceCreation.Store(true)
 	stopAllRunners()
+	closeJoinDecisionWriter()
+	closeBanEnforcement()
+	closeTournaments()
+	closeMatchmaking()
+	closeWebhookDispatcher()
+	closeDiscordBot()
+	closeModerationNotifier()
 	closeInstanceCleaner()
+	closeSchedules()
 	closeLobbyKeepalive()
 	closeWebServer()
+	if err := ISPchecker.Save(); err != nil {
+		log.Printf("Failed to save ISP cache: %s", err.Error())
+	}
 	log.Println("Shutdown complete, bye!")
 }
@@ -20,6 +20,7 @@ var (
 	errCreationDisallowed = errors.New("instance creation disallowed")
 	errNoPortsDeclared    = errors.New("no ports declared")
 	errNoFreePort         = errors.New("no free ports")
+	errInstanceNotFound   = errors.New("instance not found")
 )
 
 func allocateNewInstance() (inst *instance, err error) {
@@ -63,6 +64,9 @@ func allocateNewInstance() (inst *instance, err error) {
 		RoomStatus:     lac.NewConf(),
 		pokeRequests:   make(chan int, 20),
 		pokeCancels:    make(chan string, 20),
+		readyPlayers:   map[string]int{},
+		playerLangs:    map[string]string{},
+		lobbyJoinTimes: map[string]time.Time{},
 	}
 
 	instances = append(instances, inst)
@@ -159,6 +163,30 @@ func isQueueInLobbyNOLOCK(queueName string) int64 {
 	return 0
 }
 
+func queueLobbyInstances(queueName string) []int64 {
+	instancesLock.Lock()
+	defer instancesLock.Unlock()
+	ret := []int64{}
+	for i := range instances {
+		if instances[i].QueueName == queueName && instances[i].state.Load() <= int64(instanceStateInLobby) {
+			ret = append(ret, instances[i].Id)
+		}
+	}
+	return ret
+}
+
+func queueRunningInstancesCount(queueName string) int {
+	instancesLock.Lock()
+	defer instancesLock.Unlock()
+	ret := 0
+	for i := range instances {
+		if instances[i].QueueName == queueName && instances[i].state.Load() == int64(instanceStateInGame) {
+			ret++
+		}
+	}
+	return ret
+}
+
 func isInstanceInLobby(instanceID int64) bool {
 	instancesLock.Lock()
 	defer instancesLock.Unlock()
@@ -177,6 +205,17 @@ func isInstanceInLobbyNOLOCK(instanceID int64) bool {
 	return false
 }
 
+func isInstanceAlive(instanceID int64) bool {
+	instancesLock.Lock()
+	defer instancesLock.Unlock()
+	for i := range instances {
+		if instances[i].Id == instanceID {
+			return instances[i].state.Load() < int64(instanceStateExited)
+		}
+	}
+	return false
+}
+
 func sendShutdownIfRerollable(instanceID int64) bool {
 	instancesLock.Lock()
 	defer instancesLock.Unlock()
@@ -213,3 +252,39 @@ func sendShutdownIfRerollableNOLOCK(instanceID int64) bool {
 	}
 	return false
 }
+
+func sendInstanceCommand(instanceID int64, cmd instanceCommand) bool {
+	instancesLock.Lock()
+	defer instancesLock.Unlock()
+	for _, inst := range instances {
+		if inst.Id != instanceID {
+			continue
+		}
+		select {
+		case inst.commands <- cmd:
+			return true
+		default:
+			inst.logger.Printf("command channel full, dropping command %#+v", cmd)
+			return false
+		}
+	}
+	return false
+}
+
+func broadcastInstanceCommand(cmd instanceCommand) int {
+	instancesLock.Lock()
+	defer instancesLock.Unlock()
+	sent := 0
+	for _, inst := range instances {
+		if instanceState(inst.state.Load()) >= instanceStateExiting {
+			continue
+		}
+		select {
+		case inst.commands <- cmd:
+			sent++
+		default:
+			inst.logger.Printf("command channel full, dropping command %#+v", cmd)
+		}
+	}
+	return sent
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/maxsupermanhd/lac/v2"
+)
+
+func queueMapHashes() []string {
+	ret := []string{}
+	queuesK, _ := cfg.GetKeys("queues")
+	for _, q := range queuesK {
+		mapnames, _ := cfg.GetKeys("queues", q, "maps")
+		for _, m := range mapnames {
+			h, ok := cfg.GetString("queues", q, "maps", m, "hash")
+			if ok {
+				ret = append(ret, h)
+			}
+		}
+	}
+	ret = removeDuplicate(ret)
+	sort.Strings(ret)
+	return ret
+}
+
+// returns count of maps that failed to fetch and queues with invalid maps
+func prefetchQueueMaps() int {
+	hashes := queueMapHashes()
+	log.Printf("Prefetching %d maps referenced in queues", len(hashes))
+	errs := ms.Prefetch(hashes)
+	for h, err := range errs {
+		log.Printf("Failed to prefetch map %s: %s", h, err.Error())
+	}
+	log.Printf("Prefetched %d maps, %d failed", len(hashes)-len(errs), len(errs))
+	problems := validateQueueMaps(cfg)
+	for q, p := range problems {
+		for _, v := range p {
+			log.Printf("Queue %q: %s", q, v)
+		}
+	}
+	return len(errs) + len(problems)
+}
+
+// checks every queue map against its metadata, returns problems by queue
+func validateQueueMaps(c lac.Conf) map[string][]string {
+	ret := map[string][]string{}
+	queuesK, _ := c.GetKeys("queues")
+	for _, q := range queuesK {
+		queuePlayers := c.GetDInt(-1, "queues", q, "players")
+		mapnames, _ := c.GetKeys("queues", q, "maps")
+		for _, m := range mapnames {
+			h, ok := c.GetString("queues", q, "maps", m, "hash")
+			if !ok {
+				ret[q] = append(ret[q], fmt.Sprintf("map %q has no hash", m))
+				continue
+			}
+			md, err := ms.GetMapMetadata(h)
+			if err != nil {
+				ret[q] = append(ret[q], fmt.Sprintf("map %q metadata: %s", m, err.Error()))
+				continue
+			}
+			players := c.GetDInt(queuePlayers, "queues", q, "maps", m, "players")
+			if md.Players != players {
+				ret[q] = append(ret[q], fmt.Sprintf("map %q is for %d players but queue expects %d", m, md.Players, players))
+			}
+		}
+	}
+	return ret
+}
+
+// runs in background on startup, maps may need to be downloaded
+func validateQueueMapsOnStartup() {
+	problems := validateQueueMaps(cfg)
+	for q, p := range problems {
+		for _, v := range p {
+			log.Printf("Queue %q: %s", q, v)
+		}
+		discordPostError("Queue %q has invalid maps: %s", q, strings.Join(p, "; "))
+	}
+}
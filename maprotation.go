@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// map rotation is configured per queue under "mapRotation":
+// "strategy" is one of random (default), weighted ("maps.<name>.weight"),
+// roundrobin or leastRecent (by games history),
+// "avoidLast" excludes maps that were picked recently,
+// "timePools" restricts maps to [{fromHour, toHour, maps}] in "timezone"
+
+type mapRotationTimePool struct {
+	FromHour int      `mapstructure:"fromHour"`
+	ToHour   int      `mapstructure:"toHour"`
+	Maps     []string `mapstructure:"maps"`
+}
+
+var (
+	mapRotationLock     sync.Mutex
+	mapRotationHistory  = map[string][]string{}
+	mapRotationCounters = map[string]int{}
+)
+
+// history is kept per queue, rooms without queue share it by map list
+func mapRotationKey(queueName string, mapnames []string) string {
+	if queueName != "" {
+		return "queue:" + queueName
+	}
+	s := slices.Clone(mapnames)
+	slices.Sort(s)
+	return strings.Join(s, ",")
+}
+
+func mapRotationPick(inst *instance, queueName string, mapnames []string) string {
+	slices.Sort(mapnames)
+	key := mapRotationKey(queueName, mapnames)
+	candidates := mapRotationFilterTime(inst, mapnames)
+
+	avoid := inst.cfg.GetDInt(0, "mapRotation", "avoidLast")
+	mapRotationLock.Lock()
+	history := slices.Clone(mapRotationHistory[key])
+	mapRotationLock.Unlock()
+	if avoid > 0 {
+		recent := history[max(len(history)-avoid, 0):]
+		filtered := slices.DeleteFunc(slices.Clone(candidates), func(m string) bool {
+			return slices.Contains(recent, m)
+		})
+		if len(filtered) > 0 {
+			candidates = filtered
+		}
+	}
+
+	var picked string
+	switch strategy := inst.cfg.GetDString("random", "mapRotation", "strategy"); strategy {
+	case "weighted":
+		picked = mapRotationWeighted(inst, candidates)
+	case "roundrobin":
+		mapRotationLock.Lock()
+		picked = candidates[mapRotationCounters[key]%len(candidates)]
+		mapRotationCounters[key]++
+		mapRotationLock.Unlock()
+	case "leastRecent":
+		picked = mapRotationLeastRecent(inst, candidates)
+	default:
+		if strategy != "random" {
+			inst.logger.Printf("Unknown map rotation strategy %q, using random", strategy)
+		}
+		picked = candidates[rand.Intn(len(candidates))]
+	}
+
+	mapRotationLock.Lock()
+	history = append(mapRotationHistory[key], picked)
+	if len(history) > 32 {
+		history = history[len(history)-32:]
+	}
+	mapRotationHistory[key] = history
+	mapRotationLock.Unlock()
+	return picked
+}
+
+func mapRotationFilterTime(inst *instance, mapnames []string) []string {
+	pools := []mapRotationTimePool{}
+	err := inst.cfg.GetToStruct(&pools, "mapRotation", "timePools")
+	if err != nil || len(pools) == 0 {
+		return mapnames
+	}
+	loc, err := time.LoadLocation(inst.cfg.GetDString("UTC", "mapRotation", "timezone"))
+	if err != nil {
+		inst.logger.Printf("Failed to load map rotation timezone: %s", err.Error())
+		loc = time.UTC
+	}
+	hour := time.Now().In(loc).Hour()
+	for _, p := range pools {
+		inPool := hour >= p.FromHour && hour < p.ToHour
+		if p.FromHour > p.ToHour {
+			inPool = hour >= p.FromHour || hour < p.ToHour
+		}
+		if !inPool {
+			continue
+		}
+		ret := []string{}
+		for _, m := range p.Maps {
+			if slices.Contains(mapnames, m) {
+				ret = append(ret, m)
+			}
+		}
+		if len(ret) > 0 {
+			return ret
+		}
+	}
+	return mapnames
+}
+
+func mapRotationWeighted(inst *instance, candidates []string) string {
+	total := 0
+	weights := make([]int, len(candidates))
+	for i, m := range candidates {
+		weights[i] = max(inst.cfg.GetDInt(1, "maps", m, "weight"), 0)
+		total += weights[i]
+	}
+	if total == 0 {
+		return candidates[rand.Intn(len(candidates))]
+	}
+	r := rand.Intn(total)
+	for i, w := range weights {
+		if r < w {
+			return candidates[i]
+		}
+		r -= w
+	}
+	return candidates[len(candidates)-1]
+}
+
+// maps that were never played win, ties are broken randomly
+func mapRotationLeastRecent(inst *instance, candidates []string) string {
+	hashes := []string{}
+	for _, m := range candidates {
+		hashes = append(hashes, inst.cfg.GetDString("", "maps", m, "hash"))
+	}
+	lastPlayed := map[string]int{}
+	var hash string
+	var lastGame int
+	_, err := dbpool.QueryFunc(context.Background(), `select map_hash, max(id) from games where map_hash = any($1) group by map_hash`,
+		[]any{hashes}, []any{&hash, &lastGame}, func(_ pgx.QueryFuncRow) error {
+			lastPlayed[hash] = lastGame
+			return nil
+		})
+	if err != nil {
+		inst.logger.Printf("Failed to query map history, using random: %s", err.Error())
+		return candidates[rand.Intn(len(candidates))]
+	}
+	best := []string{}
+	bestGame := -1
+	for i, m := range candidates {
+		g := lastPlayed[hashes[i]]
+		if bestGame == -1 || g < bestGame {
+			best = []string{m}
+			bestGame = g
+		} else if g == bestGame {
+			best = append(best, m)
+		}
+	}
+	return best[rand.Intn(len(best))]
+}
@@ -1,22 +1,46 @@
 package mapstorage
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
 	"io/fs"
+	"log"
+	"net/http"
 	"os"
 	"path"
+	"slices"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
 	mapsdatabase "github.com/maxsupermanhd/go-wz/maps-database"
 	"github.com/maxsupermanhd/lac/v2"
 )
 
+// sources are tried in order, each is one of:
+// "database" - maps database (default),
+// "dir:<path>" - local directory with <hash>.wz files,
+// "http://..." or "https://..." - url with {hash} placeholder
+
+var (
+	ErrHashMismatch = errors.New("map hash mismatch")
+	ErrTooBig       = errors.New("map is too big")
+	ErrNoSources    = errors.New("map not found in any source")
+)
+
 type Mapstorage struct {
-	fslock sync.Mutex
-	cfg    lac.Conf
+	fslock   sync.Mutex
+	cfg      lac.Conf
+	pinned   map[string]bool
+	metadata map[string]*MapMetadata
 }
 
 func NewMapstorage(cfg lac.Conf) (*Mapstorage, error) {
-	m := &Mapstorage{cfg: cfg}
+	m := &Mapstorage{cfg: cfg, pinned: map[string]bool{}, metadata: map[string]*MapMetadata{}}
 	return m, os.MkdirAll(m.getRoot(), fs.FileMode(m.cfg.GetDInt(766, "dirPerms")))
 }
 
@@ -28,23 +52,193 @@ func (m *Mapstorage) getMapPath(hash string) string {
 	return path.Join(m.getRoot(), hash+".wz")
 }
 
+func (m *Mapstorage) maxSize() int {
+	return m.cfg.GetDInt(32, "maxSizeMB") * 1024 * 1024
+}
+
+func verifyHash(hash string, b []byte) error {
+	sum := sha256.Sum256(b)
+	if !strings.EqualFold(hex.EncodeToString(sum[:]), hash) {
+		return ErrHashMismatch
+	}
+	return nil
+}
+
+// pinned maps are never evicted from the cache
+func (m *Mapstorage) Pin(hashes ...string) {
+	m.fslock.Lock()
+	defer m.fslock.Unlock()
+	for _, h := range hashes {
+		m.pinned[strings.ToLower(h)] = true
+	}
+}
+
+func (m *Mapstorage) isPinnedNOLOCK(hash string) bool {
+	return m.pinned[hash] || slices.Contains(m.cfg.GetDSliceString([]string{}, "pinned"), hash)
+}
+
 func (m *Mapstorage) GetMap(hash string) ([]byte, error) {
+	hash = strings.ToLower(hash)
 	p := m.getMapPath(hash)
 	m.fslock.Lock()
 	ret, err := os.ReadFile(p)
-	m.fslock.Unlock()
 	if err == nil {
-		return ret, nil
-	}
-	if !os.IsNotExist(err) {
+		err = verifyHash(hash, ret)
+		if err == nil {
+			now := time.Now()
+			os.Chtimes(p, now, now)
+			m.fslock.Unlock()
+			return ret, nil
+		}
+		log.Printf("Map %s on disk is corrupted, fetching again", hash)
+		os.Remove(p)
+	} else if !os.IsNotExist(err) {
+		m.fslock.Unlock()
 		return nil, err
 	}
-	ret, err = mapsdatabase.FetchMapBlob(hash)
+	m.fslock.Unlock()
+	ret, err = m.fetch(hash)
 	if err != nil {
 		return nil, err
 	}
 	m.fslock.Lock()
-	err = os.WriteFile(p, ret, fs.FileMode(m.cfg.GetDInt(644, "filePerms")))
-	m.fslock.Unlock()
-	return ret, err
+	defer m.fslock.Unlock()
+	err = m.writeAtomicNOLOCK(p, ret)
+	if err != nil {
+		return ret, err
+	}
+	m.evictNOLOCK()
+	return ret, nil
+}
+
+func (m *Mapstorage) fetch(hash string) ([]byte, error) {
+	sources := m.cfg.GetDSliceString([]string{"database"}, "sources")
+	retries := m.cfg.GetDInt(2, "fetchRetries")
+	errs := []error{}
+	for _, s := range sources {
+		for try := 0; try <= retries; try++ {
+			b, err := m.fetchFrom(s, hash)
+			if err == nil && len(b) > m.maxSize() {
+				err = ErrTooBig
+			}
+			if err == nil {
+				err = verifyHash(hash, b)
+			}
+			if err == nil {
+				return b, nil
+			}
+			errs = append(errs, fmt.Errorf("%s: %w", s, err))
+			if os.IsNotExist(err) || errors.Is(err, ErrTooBig) || errors.Is(err, ErrHashMismatch) {
+				break
+			}
+			time.Sleep(time.Duration(try+1) * time.Second)
+		}
+	}
+	return nil, errors.Join(append([]error{ErrNoSources}, errs...)...)
+}
+
+func (m *Mapstorage) fetchFrom(source, hash string) ([]byte, error) {
+	switch {
+	case source == "database":
+		return mapsdatabase.FetchMapBlob(hash)
+	case strings.HasPrefix(source, "dir:"):
+		return os.ReadFile(path.Join(strings.TrimPrefix(source, "dir:"), hash+".wz"))
+	case strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://"):
+		cl := http.Client{Timeout: 30 * time.Second}
+		rsp, err := cl.Get(strings.ReplaceAll(source, "{hash}", hash))
+		if err != nil {
+			return nil, err
+		}
+		defer rsp.Body.Close()
+		if rsp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("status code %d", rsp.StatusCode)
+		}
+		return io.ReadAll(io.LimitReader(rsp.Body, int64(m.maxSize())+1))
+	}
+	return nil, fmt.Errorf("unknown map source %q", source)
+}
+
+func (m *Mapstorage) writeAtomicNOLOCK(p string, b []byte) error {
+	f, err := os.CreateTemp(m.getRoot(), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(b)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), fs.FileMode(m.cfg.GetDInt(644, "filePerms")))
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), p)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// removes least recently used maps until cache fits "maxCacheMB", 0 is unlimited
+func (m *Mapstorage) evictNOLOCK() {
+	limit := int64(m.cfg.GetDInt(0, "maxCacheMB")) * 1024 * 1024
+	if limit <= 0 {
+		return
+	}
+	entries, err := os.ReadDir(m.getRoot())
+	if err != nil {
+		log.Printf("Failed to list map storage: %s", err.Error())
+		return
+	}
+	type cachedMap struct {
+		hash    string
+		size    int64
+		modTime time.Time
+	}
+	cached := []cachedMap{}
+	total := int64(0)
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".wz") {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		total += info.Size()
+		cached = append(cached, cachedMap{hash: strings.TrimSuffix(e.Name(), ".wz"), size: info.Size(), modTime: info.ModTime()})
+	}
+	sort.Slice(cached, func(i, j int) bool {
+		return cached[i].modTime.Before(cached[j].modTime)
+	})
+	for _, c := range cached {
+		if total <= limit {
+			return
+		}
+		if m.isPinnedNOLOCK(c.hash) {
+			continue
+		}
+		err = os.Remove(m.getMapPath(c.hash))
+		if err != nil {
+			log.Printf("Failed to evict map %s: %s", c.hash, err.Error())
+			continue
+		}
+		total -= c.size
+	}
+}
+
+// fetches and pins every map, returns errors by hash
+func (m *Mapstorage) Prefetch(hashes []string) map[string]error {
+	m.Pin(hashes...)
+	ret := map[string]error{}
+	for _, h := range hashes {
+		_, err := m.GetMap(h)
+		if err != nil {
+			ret[h] = err
+		}
+	}
+	return ret
 }
@@ -0,0 +1,172 @@
+package mapstorage
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+type MapMetadata struct {
+	Name    string
+	Players int
+	Tileset string
+	Width   int
+	Height  int
+}
+
+var (
+	ErrNoLevelInfo = errors.New("no level information found in map archive")
+
+	datasetTilesets = map[string]string{
+		"CAM_1": "arizona",
+		"CAM_2": "urban",
+		"CAM_3": "rockies",
+		"T2_C1": "arizona",
+		"T2_C2": "urban",
+		"T2_C3": "rockies",
+		"T3_C1": "arizona",
+		"T3_C2": "urban",
+		"T3_C3": "rockies",
+	}
+)
+
+func (m *Mapstorage) GetMapMetadata(hash string) (*MapMetadata, error) {
+	hash = strings.ToLower(hash)
+	m.fslock.Lock()
+	md, ok := m.metadata[hash]
+	m.fslock.Unlock()
+	if ok {
+		return md, nil
+	}
+	b, err := m.GetMap(hash)
+	if err != nil {
+		return nil, err
+	}
+	md, err = ParseMapMetadata(b)
+	if err != nil {
+		return nil, err
+	}
+	m.fslock.Lock()
+	m.metadata[hash] = md
+	m.fslock.Unlock()
+	return md, nil
+}
+
+// supports both flattened maps with level.json and legacy maps with .lev files
+func ParseMapMetadata(b []byte) (*MapMetadata, error) {
+	zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		return nil, err
+	}
+	ret := &MapMetadata{}
+	foundLevel := false
+	for _, f := range zr.File {
+		name := path.Base(f.Name)
+		switch {
+		case f.Name == "level.json":
+			err = parseLevelJSON(f, ret)
+			foundLevel = err == nil
+		case strings.HasSuffix(name, ".lev") && !foundLevel:
+			err = parseLevelLev(f, ret)
+			foundLevel = err == nil
+		case name == "game.map" && ret.Width == 0:
+			err = parseGameMap(f, ret)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !foundLevel {
+		return nil, ErrNoLevelInfo
+	}
+	return ret, nil
+}
+
+func parseLevelJSON(f *zip.File, md *MapMetadata) error {
+	r, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	var level struct {
+		Name    string `json:"name"`
+		Players int    `json:"players"`
+		Tileset string `json:"tileset"`
+	}
+	err = json.NewDecoder(r).Decode(&level)
+	if err != nil {
+		return err
+	}
+	md.Name = level.Name
+	md.Players = level.Players
+	md.Tileset = strings.ToLower(level.Tileset)
+	return nil
+}
+
+func parseLevelLev(f *zip.File, md *MapMetadata) error {
+	r, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		switch fields[0] {
+		case "level":
+			md.Name = fields[1]
+			if i := strings.LastIndex(md.Name, "-"); i > 0 {
+				md.Name = md.Name[:i]
+			}
+		case "players":
+			md.Players, err = strconv.Atoi(fields[1])
+			if err != nil {
+				return err
+			}
+		case "dataset":
+			for k, v := range datasetTilesets {
+				if strings.HasSuffix(fields[1], k) {
+					md.Tileset = v
+				}
+			}
+		}
+	}
+	return s.Err()
+}
+
+// binary map header is "map " magic, version, width and height, little endian
+func parseGameMap(f *zip.File, md *MapMetadata) error {
+	r, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	var header struct {
+		Magic   [4]byte
+		Version uint32
+		Width   uint32
+		Height  uint32
+	}
+	err = binary.Read(io.LimitReader(r, 16), binary.LittleEndian, &header)
+	if err != nil {
+		return err
+	}
+	if string(header.Magic[:]) != "map " {
+		return errors.New("game.map has wrong magic")
+	}
+	md.Width = int(header.Width)
+	md.Height = int(header.Height)
+	return nil
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"math/rand"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type mapVoteState struct {
+	candidates []string // first one is always current map
+	votes      map[string]int
+	timer      *time.Timer
+	rerolling  bool
+}
+
+func instanceChatCommandHandlerMapVote(inst *instance, args string, e chatCommandExecutor) {
+	lang := msgPlayerLang(inst, e.publicKeyB64)
+	if !tryCfgGetD(tryGetBoolGen("mapVote", "enabled"), false, inst.cfgs...) {
+		instWriteFmt(inst, `chat direct %s %s`, e.publicKeyB64, msgT(inst, lang, "mapvote.disabled"))
+		return
+	}
+	if instanceState(inst.state.Load()) != instanceStateInLobby {
+		instWriteFmt(inst, `chat direct %s %s`, e.publicKeyB64, msgT(inst, lang, "mapvote.notLobby"))
+		return
+	}
+	if !mapVoteIsPlayer(inst, e.publicKeyB64) {
+		instWriteFmt(inst, `chat direct %s %s`, e.publicKeyB64, msgT(inst, lang, "mapvote.notPlayer"))
+		return
+	}
+	if inst.mapVote == nil {
+		if args != "" {
+			instWriteFmt(inst, `chat direct %s %s`, e.publicKeyB64, msgT(inst, lang, "mapvote.notStarted"))
+			return
+		}
+		mapVoteStart(inst)
+		return
+	}
+	if inst.mapVote.rerolling {
+		instWriteFmt(inst, `chat direct %s %s`, e.publicKeyB64, msgT(inst, lang, "mapvote.over"))
+		return
+	}
+	choice, err := strconv.Atoi(args)
+	if err != nil || choice < 0 || choice >= len(inst.mapVote.candidates) {
+		instWriteFmt(inst, `chat direct %s %s`, e.publicKeyB64, msgT(inst, lang, "mapvote.usage", "max", strconv.Itoa(len(inst.mapVote.candidates)-1)))
+		return
+	}
+	inst.mapVote.votes[e.publicKeyB64] = choice
+	counts := mapVoteCounts(inst)
+	parts := []string{}
+	for i, m := range inst.mapVote.candidates {
+		parts = append(parts, fmt.Sprintf("%d) %s: %d", i, m, counts[i]))
+	}
+	instWriteFmt(inst, `chat bcast %s`, msgT(inst, msgRoomLang(inst), "mapvote.tally", "votes", strings.Join(parts, ", ")))
+	// finished from the runner loop, chat handlers can not spawn instances
+	if counts[choice] >= mapVoteThreshold(inst) {
+		inst.mapVote.timer.Stop()
+		select {
+		case inst.commands <- instanceCommand{command: icMapVoteEnd}:
+		default:
+			inst.logger.Println("command channel full, map vote will end by timer")
+			inst.mapVote.timer.Reset(time.Second)
+		}
+	}
+}
+
+func mapVoteIsPlayer(inst *instance, pubkeyB64 string) bool {
+	for _, p := range roomStatusPlayersOfType(inst.RoomStatus, "player") {
+		if pk, _ := p["pk"].(string); pk == pubkeyB64 {
+			return true
+		}
+	}
+	return false
+}
+
+// majority of players unless configured otherwise
+func mapVoteThreshold(inst *instance) int {
+	players := len(roomStatusPlayersOfType(inst.RoomStatus, "player"))
+	return max(tryCfgGetD(tryGetIntGen("mapVote", "threshold"), players/2+1, inst.cfgs...), 1)
+}
+
+func mapVoteCounts(inst *instance) []int {
+	ret := make([]int, len(inst.mapVote.candidates))
+	for _, v := range inst.mapVote.votes {
+		ret[v]++
+	}
+	return ret
+}
+
+func mapVoteStart(inst *instance) {
+	pool, _ := inst.cfg.GetKeys("maps")
+	pool = slices.DeleteFunc(pool, func(m string) bool {
+		return m == inst.Settings.MapName
+	})
+	if len(pool) == 0 {
+		instWriteFmt(inst, `chat bcast %s`, msgT(inst, msgRoomLang(inst), "mapvote.noMaps"))
+		return
+	}
+	rand.Shuffle(len(pool), func(i, j int) {
+		pool[i], pool[j] = pool[j], pool[i]
+	})
+	n := tryCfgGetD(tryGetIntGen("mapVote", "candidates"), 3, inst.cfgs...)
+	pool = pool[:min(max(n, 1), len(pool))]
+	duration := time.Duration(tryCfgGetD(tryGetIntGen("mapVote", "durationSeconds"), 60, inst.cfgs...)) * time.Second
+	inst.mapVote = &mapVoteState{
+		candidates: append([]string{inst.Settings.MapName}, pool...),
+		votes:      map[string]int{},
+		timer: time.AfterFunc(duration, func() {
+			sendInstanceCommand(inst.Id, instanceCommand{command: icMapVoteEnd})
+		}),
+	}
+	parts := []string{}
+	for i, m := range inst.mapVote.candidates {
+		parts = append(parts, fmt.Sprintf("%d) %s", i, m))
+	}
+	instWriteFmt(inst, `chat bcast %s`, msgT(inst, msgRoomLang(inst), "mapvote.started", "candidates", strings.Join(parts, ", "),
+		"duration", duration.String(), "threshold", strconv.Itoa(mapVoteThreshold(inst))))
+}
+
+// runs in runner loop after threshold is reached or timer expires
+func mapVoteFinish(inst *instance) {
+	v := inst.mapVote
+	if v == nil || v.rerolling {
+		return
+	}
+	v.timer.Stop()
+	counts := mapVoteCounts(inst)
+	winner := 0
+	for i, c := range counts {
+		if c > counts[winner] {
+			winner = i
+		}
+	}
+	if winner == 0 || instanceState(inst.state.Load()) != instanceStateInLobby {
+		inst.mapVote = nil
+		instWriteFmt(inst, `chat bcast %s`, msgT(inst, msgRoomLang(inst), "mapvote.kept", "map", inst.Settings.MapName))
+		return
+	}
+	v.rerolling = true
+	mapName := v.candidates[winner]
+	instWriteFmt(inst, `chat bcast %s`, msgT(inst, msgRoomLang(inst), "mapvote.moving", "map", mapName))
+	reserved := map[string]joinDispatch{}
+	for k, jd := range inst.OnJoinDispatch {
+		if jd.Reserved {
+			reserved[k] = jd
+		}
+	}
+	for _, p := range roomStatusPlayersOfType(inst.RoomStatus, "player") {
+		pk, ok := p["pk"].(string)
+		if !ok {
+			continue
+		}
+		if _, ok := reserved[pk]; !ok {
+			lang := msgPlayerLang(inst, pk)
+			reserved[pk] = joinDispatch{
+				AllowChat: true,
+				Messages:  []string{msgT(inst, lang, "mapvote.welcomeBack")},
+				Issued:    time.Now(),
+				Reserved:  true,
+				Lang:      lang,
+			}
+		}
+	}
+	go mapVoteReroll(inst, mapName, reserved)
+}
+
+// runs in runner loop, lets players vote again
+func mapVoteFailed(inst *instance) {
+	inst.mapVote = nil
+	instWriteFmt(inst, `chat bcast %s`, msgT(inst, msgRoomLang(inst), "mapvote.failed"))
+}
+
+func mapVoteReroll(inst *instance, mapName string, reserved map[string]joinDispatch) {
+	c := inst.cfg.DupSubTree()
+	cfgRestrictMap(c, mapName)
+	gi, err := generateInstance(c, inst.QueueName)
+	if err != nil {
+		inst.logger.Printf("Failed to generate instance for map vote: %s", err.Error())
+		if gi != nil {
+			releaseInstance(gi)
+		}
+		discordPostError("Failed to generate instance for map vote of instance %d: %s", inst.Id, err.Error())
+		sendInstanceCommand(inst.Id, instanceCommand{command: icMapVoteFailed})
+		return
+	}
+	gi.QueueName = inst.QueueName
+	gi.Origin = inst.Origin
+	gi.Access = inst.Access
+	maps.Copy(gi.OnJoinDispatch, reserved)
+	inst.logger.Printf("Map vote moved room to instance %d on %s", gi.Id, mapName)
+	go spawnRunner(gi)
+	addr := instanceJoinAddress(gi)
+	delay := time.Duration(tryCfgGetD(tryGetIntGen("mapVote", "shutdownDelaySeconds"), 30, inst.cfgs...)) * time.Second
+	instWriteFmt(inst, `chat bcast %s`, msgT(inst, msgRoomLang(inst), "mapvote.newRoom", "map", mapName, "address", addr, "duration", delay.String()))
+	time.Sleep(delay)
+	sendInstanceCommand(inst.Id, instanceCommand{command: icShutdown})
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type matchmakingTicket struct {
+	PubkeyB64       string
+	Name            string
+	IP              string
+	Queues          []string
+	Ratings         map[string]float64
+	Region          string
+	Registered      time.Time
+	WaitingInstance int64
+	MatchedInstance int64
+	MatchedAddress  string
+	Matched         time.Time
+}
+
+var (
+	matchmakingLock    sync.Mutex
+	matchmakingTickets = map[string]*matchmakingTicket{}
+
+	errMatchmakingNoQueues = errors.New("no matchmaking queues selected")
+)
+
+func isQueueMatchmaking(queueName string) bool {
+	return cfg.GetDBool(false, "queues", queueName, "matchmaking", "enabled")
+}
+
+func matchmakingQueues() []string {
+	queuesK, ok := cfg.GetKeys("queues")
+	if !ok {
+		return []string{}
+	}
+	ret := []string{}
+	for _, q := range queuesK {
+		if isQueueMatchmaking(q) && !isQueueDisabled(q) {
+			ret = append(ret, q)
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// regions are configured as "matchmaking.regions.<region>": [ASN substrings]
+func matchmakingRegion(ip string) string {
+	if ip == "" {
+		return ""
+	}
+	rsp, err := ISPchecker.Lookup(ip)
+	if err != nil {
+		log.Printf("Matchmaking failed to lookup ISP: %s", err.Error())
+		return ""
+	}
+	regions, ok := cfg.GetKeys("matchmaking", "regions")
+	if !ok {
+		return ""
+	}
+	sort.Strings(regions)
+	for _, r := range regions {
+		if stringContainsSlices(rsp.ASN, cfg.GetDSliceString([]string{}, "matchmaking", "regions", r)) {
+			return r
+		}
+	}
+	return ""
+}
+
+func matchmakingRegister(pubkeyB64, name, ip string, queues []string, waitingInstance int64) (*matchmakingTicket, error) {
+	pk, err := base64.StdEncoding.DecodeString(pubkeyB64)
+	if err != nil {
+		return nil, err
+	}
+	available := matchmakingQueues()
+	if len(queues) == 0 {
+		queues = available
+	}
+	t := &matchmakingTicket{
+		PubkeyB64:       pubkeyB64,
+		Name:            name,
+		IP:              ip,
+		Queues:          []string{},
+		Ratings:         map[string]float64{},
+		Region:          matchmakingRegion(ip),
+		Registered:      time.Now(),
+		WaitingInstance: waitingInstance,
+	}
+	for _, q := range queues {
+		if !slices.Contains(available, q) {
+			continue
+		}
+		t.Queues = append(t.Queues, q)
+		categories := cfg.GetDSliceInt([]int{}, "queues", q, "ratingCategories")
+		if len(categories) > 0 {
+			t.Ratings[q], _ = ratingLookup(categories[0], pk)
+		}
+	}
+	if len(t.Queues) == 0 {
+		return nil, errMatchmakingNoQueues
+	}
+	matchmakingLock.Lock()
+	matchmakingTickets[pubkeyB64] = t
+	matchmakingLock.Unlock()
+	return t, nil
+}
+
+func matchmakingUnregister(pubkeyB64 string) bool {
+	matchmakingLock.Lock()
+	defer matchmakingLock.Unlock()
+	_, ok := matchmakingTickets[pubkeyB64]
+	delete(matchmakingTickets, pubkeyB64)
+	return ok
+}
+
+func matchmakingSnapshot() []matchmakingTicket {
+	matchmakingLock.Lock()
+	defer matchmakingLock.Unlock()
+	ret := []matchmakingTicket{}
+	for _, t := range matchmakingTickets {
+		ret = append(ret, *t)
+	}
+	slices.SortFunc(ret, func(a, b matchmakingTicket) int {
+		return a.Registered.Compare(b.Registered)
+	})
+	return ret
+}
+
+func routineMatchmaking(closechan <-chan struct{}) {
+	for {
+		select {
+		case <-closechan:
+			return
+		case <-time.After(time.Duration(cfg.GetDInt(5, "matchmaking", "intervalSeconds")) * time.Second):
+			matchmakingProcess()
+		}
+	}
+}
+
+func matchmakingProcess() {
+	matchmakingLock.Lock()
+	ticketLifetime := time.Duration(cfg.GetDInt(900, "matchmaking", "ticketLifetimeSeconds")) * time.Second
+	for k, t := range matchmakingTickets {
+		if t.MatchedInstance == 0 && time.Since(t.Registered) > ticketLifetime {
+			matchmakingNotifyNOLOCK(t, "⚠ Your matchmaking ticket expired, use /queue to search again.")
+			delete(matchmakingTickets, k)
+		}
+		if t.MatchedInstance > 0 && time.Since(t.Matched) > ticketLifetime {
+			delete(matchmakingTickets, k)
+		}
+	}
+	if !cfg.GetDSBool(false, "allowSpawn") {
+		matchmakingLock.Unlock()
+		return
+	}
+	type matchmakingGroup struct {
+		queueName string
+		tickets   []*matchmakingTicket
+	}
+	groups := []matchmakingGroup{}
+	for _, q := range matchmakingQueues() {
+		for {
+			group := matchmakingFindGroupNOLOCK(q)
+			if group == nil {
+				break
+			}
+			// taken out of the pool while room is being generated
+			for _, t := range group {
+				t.MatchedInstance = -1
+			}
+			groups = append(groups, matchmakingGroup{queueName: q, tickets: group})
+		}
+	}
+	matchmakingLock.Unlock()
+	for _, g := range groups {
+		matchmakingSpawn(g.queueName, g.tickets)
+	}
+}
+
+func matchmakingFindGroupNOLOCK(queueName string) []*matchmakingTicket {
+	players := cfg.GetDInt(0, "queues", queueName, "players")
+	if players < 2 {
+		return nil
+	}
+	relaxAfter := time.Duration(cfg.GetDInt(120, "matchmaking", "regionRelaxSeconds")) * time.Second
+	spreadBase := float64(cfg.GetDInt(200, "matchmaking", "ratingSpread"))
+	spreadWiden := float64(cfg.GetDInt(50, "matchmaking", "ratingSpreadPerMinute"))
+	pool := []*matchmakingTicket{}
+	regions := []string{}
+	for _, t := range matchmakingTickets {
+		if t.MatchedInstance != 0 || !slices.Contains(t.Queues, queueName) {
+			continue
+		}
+		pool = append(pool, t)
+		if !slices.Contains(regions, t.Region) {
+			regions = append(regions, t.Region)
+		}
+	}
+	sort.Strings(regions)
+	for _, region := range regions {
+		candidates := []*matchmakingTicket{}
+		for _, t := range pool {
+			if t.Region == region || time.Since(t.Registered) > relaxAfter {
+				candidates = append(candidates, t)
+			}
+		}
+		if len(candidates) < players {
+			continue
+		}
+		slices.SortFunc(candidates, func(a, b *matchmakingTicket) int {
+			if a.Ratings[queueName] < b.Ratings[queueName] {
+				return -1
+			}
+			if a.Ratings[queueName] > b.Ratings[queueName] {
+				return 1
+			}
+			return a.Registered.Compare(b.Registered)
+		})
+		for i := 0; i+players <= len(candidates); i++ {
+			window := candidates[i : i+players]
+			oldest := time.Duration(0)
+			for _, t := range window {
+				oldest = max(oldest, time.Since(t.Registered))
+			}
+			spread := window[len(window)-1].Ratings[queueName] - window[0].Ratings[queueName]
+			if spread <= spreadBase+spreadWiden*oldest.Minutes() {
+				return window
+			}
+		}
+	}
+	return nil
+}
+
+func matchmakingSpawn(queueName string, group []*matchmakingTicket) {
+	gi, err := generateInstance(cfg.DupSubTree("queues", queueName), queueName)
+	matchmakingLock.Lock()
+	defer matchmakingLock.Unlock()
+	if err != nil {
+		log.Printf("Matchmaking failed to generate instance: %s", err.Error())
+		giid := int64(-1)
+		if gi != nil {
+			giid = gi.Id
+			releaseInstance(gi)
+		}
+		discordPostError("%s Matchmaking queue failed to generate instance %d: %s", time.Now(), giid, err.Error())
+		for _, t := range group {
+			t.MatchedInstance = 0
+		}
+		return
+	}
+	gi.QueueName = queueName
+	gi.Origin = "matchmaking"
+	gi.Access = &instanceAccess{
+		Pubkeys:         []string{},
+		AllowSpectators: cfg.GetDBool(false, "queues", queueName, "matchmaking", "allowSpectators"),
+	}
+	names := []string{}
+	for _, t := range group {
+		gi.Access.Pubkeys = append(gi.Access.Pubkeys, t.PubkeyB64)
+		gi.OnJoinDispatch[t.PubkeyB64] = joinDispatch{
+			AllowChat: true,
+			Messages:  []string{"☑ Welcome to your matched game, good luck and have fun!"},
+			Issued:    time.Now(),
+			Reserved:  true,
+		}
+		names = append(names, t.Name)
+		t.MatchedInstance = gi.Id
+		t.MatchedAddress = instanceJoinAddress(gi)
+		t.Matched = time.Now()
+	}
+	log.Printf("Matchmaking spawned instance %d for queue %q with %d players: %s", gi.Id, queueName, len(group), strings.Join(names, ", "))
+	go spawnRunner(gi)
+	for _, t := range group {
+		matchmakingNotifyNOLOCK(t, fmt.Sprintf("☑ Match found! Join %s", t.MatchedAddress))
+	}
+}
+
+func matchmakingNotifyNOLOCK(t *matchmakingTicket, msg string) {
+	if t.WaitingInstance == 0 {
+		return
+	}
+	sendInstanceCommand(t.WaitingInstance, instanceCommand{
+		command: icDirectMessage,
+		data: instanceCommandDirectMessage{
+			pubkeyB64: t.PubkeyB64,
+			message:   msg,
+		},
+	})
+}
+
+func instanceChatCommandHandlerQueue(inst *instance, args string, e chatCommandExecutor) {
+	if !tryCfgGetD(tryGetBoolGen("matchmakingWaitingRoom"), false, inst.cfgs...) {
+		instWriteFmt(inst, `chat direct %s ⚠ Matchmaking is not available in this room`, e.publicKeyB64)
+		return
+	}
+	if args == "leave" {
+		if matchmakingUnregister(e.publicKeyB64) {
+			instWriteFmt(inst, `chat direct %s ☑ You left matchmaking`, e.publicKeyB64)
+		} else {
+			instWriteFmt(inst, `chat direct %s ⚠ You are not in matchmaking`, e.publicKeyB64)
+		}
+		return
+	}
+	queues := strings.Fields(args)
+	// registering looks up isp and ratings, runner loop must not wait for it
+	go func(instID int64) {
+		var msg string
+		t, err := matchmakingRegister(e.publicKeyB64, e.name, e.ip, queues, instID)
+		if err != nil {
+			msg = fmt.Sprintf("⚠ Failed to join matchmaking: %s (available: %s)", err.Error(), strings.Join(matchmakingQueues(), ", "))
+		} else {
+			msg = fmt.Sprintf("☑ Searching for a game in %s, you will be notified here", strings.Join(t.Queues, ", "))
+		}
+		sendInstanceCommand(instID, instanceCommand{
+			command: icDirectMessage,
+			data: instanceCommandDirectMessage{
+				pubkeyB64: e.publicKeyB64,
+				message:   msg,
+			},
+		})
+	}(inst.Id)
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"slices"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -57,6 +58,8 @@ var (
 			if err != nil {
 				inst.logger.Printf("Failed to save instance recovery json: %s", err.Error())
 			}
+			webhookFire(webhookEventGameStarted, inst, nil)
+			queueDemandRecordFill(inst)
 			return false
 		},
 	}, {
@@ -75,6 +78,7 @@ var (
 				inst.logger.Printf("Failed to save instance recovery json: %s", err.Error())
 			}
 			inst.logger.Printf("lobbyid %d", inst.LobbyId)
+			webhookFire(webhookEventLobbyAssigned, inst, nil)
 			return false
 		},
 	}, {
@@ -110,19 +114,22 @@ var (
 				return true
 			}
 			pubkeyDiscovery(msgpubkey)
-			jd, action, reason := joinCheck(inst, msgip, string(msgname), msgpubkey, msgb64pubkey)
+			joinCheckStart := time.Now()
+			jc := joinCheck(inst, msgip, string(msgname), msgpubkey, msgb64pubkey)
+			joinCheckLatency := time.Since(joinCheckStart)
 			addChatLog(msgip, string(msgname), msgpubkey, "", "joinattempt")
+			jd, action, reason := jc.Dispatch, jc.Action, jc.Reason
 			switch action {
 
 			case joinCheckActionLevelApprove:
 				inst.logger.Printf("Action approve for %q %q", msgip, msgname)
 				instWriteFmt(inst, "join approve %s 7 %s", msgjoinid, reason)
-				inst.OnJoinDispatch[msgb64pubkey] = jd
+				setJoinDispatch(inst, msgb64pubkey, jd)
 
 			case joinCheckActionLevelApproveSpec:
 				inst.logger.Printf("Action approvespec for %q %q", msgip, msgname)
 				instWriteFmt(inst, "join approvespec %s 7 %s", msgjoinid, reason)
-				inst.OnJoinDispatch[msgb64pubkey] = jd
+				setJoinDispatch(inst, msgb64pubkey, jd)
 
 			case joinCheckActionLevelReject:
 				inst.logger.Printf("Action reject for %q %q", msgip, msgname)
@@ -133,6 +140,7 @@ var (
 				instWriteFmt(inst, "join reject %s 7 %s", msgjoinid, reason)
 				instWriteFmt(inst, "ban ip %s", msgip)
 			}
+			recordJoinDecision(inst, msgip, string(msgname), msgpubkey, jc, joinCheckLatency)
 			return false
 		},
 	}, {
@@ -184,11 +192,9 @@ var (
 				if err != nil {
 					inst.logger.Printf("Failed to log action in database: %s", err.Error())
 				}
-				instWriteFmt(inst, `ban ip %s %s`, msgip, "You were banned from joining Autohoster.\\n"+
-					"Ban reason: 4.1.7. Any manifestations of Nazism, nationalism, incitement "+
-					"of interracial, interethnic, interfaith discord and hostility, "+
-					"calls for the overthrow of the government by force.\\n\\n"+rejectContactMsg+
-					"Event ID: "+ecode)
+				moderationNotify(inst, "blacklist", string(msgname), msghash, msgip, ecode, "Unverified identity name")
+				lang := msgRoomLang(inst)
+				instWriteFmt(inst, `ban ip %s %s`, msgip, msgT(inst, lang, "reject.blacklist", "appeal", msgT(inst, lang, "reject.appeal"), "event", ecode))
 			}
 			return false
 		},
@@ -241,6 +247,7 @@ var (
 		fn: func(inst *instance, msg string) bool {
 			// WZEVENT: readyStatus=0: 14 3Ly9fTiY/YRkuu7r2ZCns/ZEYlU1bNyPDz3DUeFaaiA= dc2960759100a7ec4a5a81a21efcc8aa8682e40fd321a6ee6753d8c42f74700b V 4pSLVEjOnuKUi+KxvnVwcmVtZQ== 178.176.213.32
 			if msg == "WZEVENT: readyStatus=RESET" {
+				clear(inst.readyPlayers)
 				return false
 			}
 			var msgreadystatus, msgplayerindex int
@@ -255,6 +262,7 @@ var (
 			case inst.pokeCancels <- msgip:
 			default:
 			}
+			balancerOnReadyStatus(inst, msgreadystatus != 0, msgplayerindex, msgb64pubkey)
 			return false
 		},
 	}, {
@@ -297,7 +305,7 @@ var (
 		mSuffix: "__ENDWZROOMSTATUS__",
 		fn: func(inst *instance, msg string) bool {
 			content := []byte(msg[16 : len(msg)-19])
-			err := inst.RoomStatus.SetFromBytesJSON(content)
+			err := inst.RoomStatus.SetFromBytesJSON(roomStatusAnnotateCountries(content))
 			if err != nil {
 				inst.logger.Printf("Failed to parse room status message: %s", err.Error())
 				return true
@@ -363,6 +371,7 @@ var (
 )
 
 func messageHandlerProcessIdentityJoin(inst *instance, msgb64pubkey string) {
+	queueDemandRecordJoin(inst, msgb64pubkey)
 	motds := map[string]any{}
 	for i := len(inst.cfgs) - 1; i >= 0; i-- {
 		o, ok := inst.cfgs[i].GetKeys("motds")
@@ -388,8 +397,12 @@ func messageHandlerProcessIdentityJoin(inst *instance, msgb64pubkey string) {
 	for _, k := range keys {
 		instWriteFmt(inst, `chat direct %s %s`, msgb64pubkey, motds[k])
 	}
-	instWriteFmt(inst, `chat direct %s ⚠ This game has time limit of %d minutes.`, msgb64pubkey, inst.Settings.TimeLimit)
 	d, ok := inst.OnJoinDispatch[msgb64pubkey]
+	if ok && d.Lang != "" {
+		inst.playerLangs[msgb64pubkey] = d.Lang
+	}
+	lang := msgPlayerLang(inst, msgb64pubkey)
+	instWriteFmt(inst, `chat direct %s %s`, msgb64pubkey, msgT(inst, lang, "join.timeLimit", "minutes", strconv.Itoa(inst.Settings.TimeLimit)))
 	if ok {
 		if d.AllowChat {
 			inst.logger.Printf("allowing chat for %s", msgb64pubkey)
@@ -398,11 +411,20 @@ func messageHandlerProcessIdentityJoin(inst *instance, msgb64pubkey string) {
 		for _, v := range d.Messages {
 			instWriteFmt(inst, `chat direct %s %s`, msgb64pubkey, v)
 		}
-		delete(inst.OnJoinDispatch, msgb64pubkey)
+		if d.Reserved {
+			inst.OnJoinDispatch[msgb64pubkey] = joinDispatch{
+				Messages: d.ReservedMessages,
+				Issued:   d.Issued,
+				Reserved: true,
+				Lang:     d.Lang,
+			}
+		} else {
+			delete(inst.OnJoinDispatch, msgb64pubkey)
+		}
 	}
 	toDeleteKeys := []string{}
 	for k, v := range inst.OnJoinDispatch {
-		if time.Since(v.Issued) > 15*time.Second {
+		if !v.Reserved && time.Since(v.Issued) > 15*time.Second {
 			toDeleteKeys = append(toDeleteKeys, k)
 		}
 	}
@@ -411,6 +433,22 @@ func messageHandlerProcessIdentityJoin(inst *instance, msgb64pubkey string) {
 	}
 }
 
+// reserved dispatches were put in place before the room was spawned,
+// their messages go first and they stay reserved for reconnects
+func setJoinDispatch(inst *instance, pubkeyB64 string, jd joinDispatch) {
+	r, ok := inst.OnJoinDispatch[pubkeyB64]
+	if ok && r.Reserved {
+		base := r.ReservedMessages
+		if base == nil {
+			base = r.Messages
+		}
+		jd.Reserved = true
+		jd.ReservedMessages = slices.Clone(base)
+		jd.Messages = slices.Concat(base, jd.Messages)
+	}
+	inst.OnJoinDispatch[pubkeyB64] = jd
+}
+
 func messageHandlerProcessChat(inst *instance, msg string) bool {
 	// WZCHATGAM: <index> <ip> <hash> <b64pubkey> dmF1dCDOo86RIFtHTl0= dmF1dCDOo86RIFtHTl0gKEdsb2JhbCk6IGdn V
 	// WZCHATCMD: <index> <ip> <hash> <b64pubkey> <b64name> <b64msg>
@@ -448,9 +486,9 @@ func messageHandlerProcessChat(inst *instance, msg string) bool {
 		if err != nil {
 			inst.logger.Printf("Failed to log action in database: %s", err.Error())
 		}
-		reason := fmt.Sprintf("You were banned from joining Autohoster.\\n"+
-			"Ban reason: 4.1.7. Any manifestations of Nazism, nationalism, incitement of interracial, interethnic, interfaith discord and hostility, calls for the overthrow of the government by force.\\n\\n"+
-			"Event ID: %s", ecode)
+		moderationNotify(inst, "blacklist", string(msgname), msghash, msgip, ecode, fmt.Sprintf("Chat message: %q", string(msgcontent)))
+		lang := msgPlayerLang(inst, msgb64pubkey)
+		reason := msgT(inst, lang, "reject.blacklist", "appeal", "", "event", ecode)
 		instWriteFmt(inst, "ban ip %s %s", msgip, reason)
 	}
 	err = addChatLog(msgip, string(msgname), msgpubkey, string(msgcontent), msgtype)
@@ -458,7 +496,7 @@ func messageHandlerProcessChat(inst *instance, msg string) bool {
 		inst.logger.Printf("Failed to log chat of instance `%d`: %s (%q: %q), was fed %q", inst.Id, err.Error(), string(msgname), string(msgcontent), origmsg)
 		discordPostError("Failed to log chat of instance `%d`: %s (%q: %q), was fed %q", inst.Id, err.Error(), string(msgname), string(msgcontent), origmsg)
 	}
-	chatSpamHit(inst, string(msgcontent), msgip, msgb64pubkey)
+	chatSpamHit(inst, string(msgcontent), msgip, msgb64pubkey, string(msgname), msghash)
 	if msgtype == "WZCHATCMD" {
 		instanceChatCommandHandle(inst, string(msgcontent), msghash, msgb64pubkey, msgpubkey, string(msgname), msgip)
 	}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"maps"
+	"net/http"
+	"strings"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// player facing texts, operators override or translate them with
+// "messages.<language>.<key>" (per queue or globally), {placeholders}
+// are filled from arguments and "messageVars"
+var messageCatalog = map[string]string{
+	"reject.appeal":          "You can contact {community} administration to appeal or get additional information: {contactURL}\\n\\n",
+	"reject.blacklist":       "You were banned from joining {community}.\\nBan reason: 4.1.7. Any manifestations of Nazism, nationalism, incitement of interracial, interethnic, interfaith discord and hostility, calls for the overthrow of the government by force.\\n\\n{appeal}Event ID: {event}",
+	"reject.votekicked":      "You got votekicked. You will be able to join back in {duration}. If you feel like it is being abused, contact administrators.",
+	"reject.banned":          "You were banned from joining {community}.\\nBan reason: {reason}\\n\\n{appeal}Ban issued: {issued}\\nBan expires: {expires}\\nEvent ID: {event}",
+	"reject.reserved":        "You can not join this game.\\n\\nThis room is reserved for specific players. Ask the room creator to add you.",
+	"reject.isp":             "You were rejected from joining {community}.\\nReason: 2.1.1. Disruption or other interference with the system with or without defined purpose.\\n\\nIf you believe it is a mistake, feel free to contact us: {contactURL}\\n\\nPlease provide event ID: {event} with your request.",
+	"reject.nonLinked":       "You can not join this game.\\n\\nYou must join with linked player identity. Link one at:\\n{wzlinkURL}\\n\\nDo not bother admins/moderators about this.",
+	"reject.region":          "You can not join this game.\\n\\nThis room is only available to players from {allowed}, your connection appears to be from {country}.",
+	"reject.netNonLinked":    "You can not join this game.\\n\\nJoining from {network} networks requires linked player identity. Link one at:\\n{wzlinkURL}",
+	"reject.terminated":      "You were rejected from joining {community}.\\nYour identity is linked to terminated account. Joining with terminated account is not allowed.\\n\\nIf you believe it is a mistake, feel free to contact us: {contactURL}\\n\\nPlease provide event ID: {event} with your request.",
+	"ban.expiresNever":       "never",
+	"kick.banned":            "You were banned from {community}.\\nBan reason: {reason}\\n\\n{appeal}Event ID: {event}",
+	"kick.afk":               "You got kicked for afk. You can rejoin immediately. If you feel like it is being abused, contact administrators.",
+	"join.bannedChat":        "⚠ You are banned from chatting in this room (ban ID: {event})",
+	"join.bannedPlay":        "⚠ You are banned from participating in this game (ban ID: {event})",
+	"join.bannedLeave":       "⚠ You are banned from this room, please leave it (ban ID: {event})",
+	"join.reservedSpec":      "⚠ This room is reserved for specific players, you can only spectate",
+	"join.reservedCode":      "⚠ If you have an invite code, write /invite <code> and rejoin",
+	"join.nonLinkedPlay":     "⚠ You are not allowed to participate in this game due to being not registered",
+	"join.nonLinkedChat":     "⚠ You are not allowed to chat in this room due to being not registered",
+	"join.linkIdentity":      "⚠ Link your identity at {wzlinkURL}",
+	"join.rateLimited":       "⚠ You were automatically rate limited for leaving the game early. Do not contact admins/moderators about this, they will not help you",
+	"join.movedOut":          "⚠ You are not allowed to participate in the game because moderator moved you out earlier",
+	"join.ipMute":            "⚠ You are not allowed to use free chat because you are not linked to an account. Link today at {siteURL}",
+	"join.ipNoPlay":          "⚠ You are not allowed to participate because you are not linked to an account. Link today at {siteURL}",
+	"join.defaultName":       "⚠ You are not allowed to participate in the game because you are using default name, please change it in top left field and rejoin.",
+	"join.spamMuted":         "⚠ You are temporarily not allowed to use free chat because you spammed in chat.",
+	"join.timeLimit":         "⚠ This game has time limit of {minutes} minutes.",
+	"votekick.disabled":      "⚠ Votekick is disabled in this room.",
+	"votekick.linked":        "⚠ Votekick avaliable only to registered and linked players.",
+	"votekick.shortID":       "⚠ Votekick player ID prefix must be at least 3 characters long",
+	"votekick.invalidID":     "⚠ Votekick provided player ID prefix is invalid",
+	"votekick.notFound":      "⚠ Votekick player not found",
+	"votekick.collision":     "⚠ Provide longer votekick player ID, collision detected",
+	"votekick.wait":          "⚠ Please wait for {duration} to cast your next vote",
+	"votekick.progress":      "⚠ Votekick of player {hash} ({name}): votes {votes}/{required}",
+	"spam.muted":             "⚠ You were automatically muted for chat spam.",
+	"spam.warning":           "⚠ Please do not spam, it does not help anyone. Become moderator instead and kick out afk people.",
+	"link.invalidCode":       "⚠ Invalid code, please get one at {wzlinkURL}",
+	"link.error":             "⚠ Something went wrong, contact administrators for assistance.",
+	"link.unconfirmed":       "⚠ Email not confirmed. Please confirm your email to link an identity. If you need to re-send confirmation email or change your address contact Administrators.",
+	"link.claimed":           "⚠ Identity already claimed, contact administrators if you are confused.",
+	"link.success":           "☑ Identity linked successfully",
+	"poke.usage":             "⚠ Poke requires numerical player slot as argument!",
+	"poke.registered":        "⚠ Poke is only available for registered players! ({registerURL})",
+	"poke.failed":            "⚠ Failed to process poke!",
+	"poke.ongoing":           "⚠ Poke for slot {slot} is ongoing!",
+	"poke.disabled":          "⚠ Poke is disabled in this room!",
+	"poke.cooldown":          "⚠ Poke is on cooldown! (available in {eta})",
+	"poke.disabledCountdown": "⚠ Poke is disabled in this room! (via countdown)",
+	"poke.notFound":          "⚠ Poke failed to locate player.",
+	"poke.cancelled":         "⚠ Poke has been cancelled for slot {slot}.",
+	"poke.lostTarget":        "⚠ Poke lost target.",
+	"poke.countdown":         "⚠ Poke will kick slot {slot} for being afk in {seconds}.",
+	"poke.countdownYou":      "⚠ Poke will kick YOU for being afk in {seconds} seconds! (write in chat to show activity)",
+	"chat.stats":             "Game history of {community} is available at the website: {siteURL}games (with detailed statistics, charts and replay for download)",
+	"invite.notUsed":         "⚠ This room does not use invites",
+	"invite.failed":          "⚠ Failed to use invite: {error}",
+	"invite.accepted":        "☑ Invite accepted, rejoin the room to take a player slot",
+	"mapvote.disabled":       "⚠ Map voting is not enabled in this room",
+	"mapvote.notLobby":       "⚠ Map can only be changed in lobby",
+	"mapvote.notPlayer":      "⚠ Only players can vote for the map",
+	"mapvote.notStarted":     "⚠ There is no map vote going on, start one with /mapvote",
+	"mapvote.over":           "⚠ Map vote is already over",
+	"mapvote.usage":          "⚠ Vote with /mapvote (number from 0 to {max})",
+	"mapvote.tally":          "🗳 Map vote: {votes}",
+	"mapvote.noMaps":         "⚠ There are no other maps to vote for",
+	"mapvote.started":        "🗳 Map vote started: {candidates}. Vote with /mapvote (number), 0 keeps current map. Vote ends in {duration} or when {threshold} players agree.",
+	"mapvote.kept":           "🗳 Map vote is over, map stays {map}",
+	"mapvote.moving":         "🗳 Map vote is over, moving room to {map}...",
+	"mapvote.welcomeBack":    "☑ Welcome back, map was changed by vote",
+	"mapvote.failed":         "⚠ Failed to change the map, sorry!",
+	"mapvote.newRoom":        "🗳 New room on {map} is starting, join {address} (this room closes in {duration})",
+	"balance.suggested":      "⚖ Suggested teams by rating: {teamA} ({ratingA}) vs {teamB} ({ratingB}), predicted win chance of first team is {chance}%, swap slots to play balanced game",
+	"balance.applied":        "⚖ Teams were balanced by rating: team 1 ({ratingA}) vs team 2 ({ratingB}), predicted win chance of team 1 is {chance}%",
+}
+
+var messageVars = map[string]string{
+	"community":   "Autohoster",
+	"siteURL":     "https://wz2100-autohost.net/",
+	"wzlinkURL":   "https://wz2100-autohost.net/wzlink",
+	"registerURL": "https://wz2100-autohost.net/register",
+	"contactURL":  "https://wz2100-autohost.net/about#contact",
+}
+
+// inst can be nil, then only global config is used
+func msgLookup(inst *instance, k ...string) *string {
+	if inst != nil {
+		if v := tryCfgGet(tryGetStringGen(k...), inst.cfgs...); v != nil {
+			return v
+		}
+	}
+	if v, ok := cfg.GetString(k...); ok {
+		return &v
+	}
+	return nil
+}
+
+// args are pairs of placeholder name and value
+func msgT(inst *instance, lang string, key string, args ...string) string {
+	text, ok := messageCatalog[key]
+	if v := msgLookup(inst, "messages", lang, key); v != nil {
+		text = *v
+	} else if v := msgLookup(inst, "messages", "en", key); v != nil {
+		text = *v
+	} else if !ok {
+		return key
+	}
+	pairs := []string{}
+	for i := 0; i+1 < len(args); i += 2 {
+		pairs = append(pairs, "{"+args[i]+"}", args[i+1])
+	}
+	for k, d := range messageVars {
+		v := d
+		if o := msgLookup(inst, "messageVars", k); o != nil {
+			v = *o
+		}
+		pairs = append(pairs, "{"+k+"}", v)
+	}
+	return strings.NewReplacer(pairs...).Replace(text)
+}
+
+func msgRoomLang(inst *instance) string {
+	if v := msgLookup(inst, "language"); v != nil {
+		return *v
+	}
+	return "en"
+}
+
+// language from account settings, room language if not set
+func msgAccountLang(inst *instance, account *int) string {
+	if account == nil {
+		return msgRoomLang(inst)
+	}
+	var lang string
+	err := dbpool.QueryRow(context.Background(), `select coalesce(language, '') from accounts where id = $1`, *account).Scan(&lang)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		inst.logger.Printf("Failed to get account language: %s", err.Error())
+	}
+	if lang == "" {
+		return msgRoomLang(inst)
+	}
+	return lang
+}
+
+// runs in runner loop, language is remembered on join from join checks,
+// players that joined before backend restart are looked up once
+func msgPlayerLang(inst *instance, pubkeyB64 string) string {
+	if lang, ok := inst.playerLangs[pubkeyB64]; ok {
+		return lang
+	}
+	pubkey, err := base64.StdEncoding.DecodeString(pubkeyB64)
+	if err != nil {
+		return msgRoomLang(inst)
+	}
+	var lang string
+	err = dbpool.QueryRow(context.Background(), `select coalesce(a.language, '')
+from accounts as a
+join identities as i on i.account = a.id
+where i.pkey = $1`, pubkey).Scan(&lang)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		inst.logger.Printf("Failed to get player language: %s", err.Error())
+		return msgRoomLang(inst)
+	}
+	if lang == "" {
+		lang = msgRoomLang(inst)
+	}
+	inst.playerLangs[pubkeyB64] = lang
+	return lang
+}
+
+func webHandleMessages(w http.ResponseWriter, r *http.Request) {
+	lang := r.URL.Query().Get("lang")
+	if lang == "" {
+		lang = "en"
+	}
+	ret := maps.Clone(messageCatalog)
+	for k := range ret {
+		ret[k] = msgT(nil, lang, k)
+	}
+	webRespondJSON(w, ret)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+type moderationEvent struct {
+	Kind       string
+	InstanceID int64
+	Queue      string
+	Name       string
+	Hash       string
+	IP         string
+	EventID    string
+	Details    string
+	When       time.Time
+}
+
+var (
+	moderationEvents = make(chan moderationEvent, 256)
+)
+
+// kind is one of spam, votekick, blacklist, antiproxy, terminated, evasion
+func moderationNotify(inst *instance, kind, name, hash, ip, eventID, details string) {
+	if !tryCfgGetD(tryGetBoolGen("moderationNotify", kind), true, inst.cfgs...) {
+		return
+	}
+	e := moderationEvent{
+		Kind:       kind,
+		InstanceID: inst.Id,
+		Queue:      inst.QueueName,
+		Name:       name,
+		Hash:       hash,
+		IP:         ip,
+		EventID:    eventID,
+		Details:    details,
+		When:       time.Now(),
+	}
+	select {
+	case moderationEvents <- e:
+	default:
+		inst.logger.Printf("Moderation notification queue is full, dropping %s event %s", kind, eventID)
+	}
+}
+
+func routineModerationNotifier(closechan <-chan struct{}) {
+	for {
+		select {
+		case <-closechan:
+			return
+		case e := <-moderationEvents:
+			webhookUrl, ok := cfg.GetString("moderationNotifications", "webhook")
+			if !ok || webhookUrl == "" {
+				continue
+			}
+			discordSendWebhookJSON(webhookUrl, moderationEventPayload(e))
+		}
+	}
+}
+
+// discord rejects whole embed if any field value is empty or too long
+func moderationEmbedValue(v string) string {
+	if v == "" {
+		return "-"
+	}
+	if r := []rune(v); len(r) > 1024 {
+		return string(r[:1021]) + "..."
+	}
+	return v
+}
+
+func moderationEventPayload(e moderationEvent) map[string]any {
+	fields := []map[string]any{
+		{"name": "Instance", "value": fmt.Sprint(e.InstanceID), "inline": true},
+		{"name": "Queue", "value": moderationEmbedValue(e.Queue), "inline": true},
+		{"name": "Event ID", "value": moderationEmbedValue(e.EventID), "inline": true},
+		{"name": "Player", "value": moderationEmbedValue(strings.ReplaceAll(e.Name, "\n", "")), "inline": true},
+		{"name": "Hash", "value": moderationEmbedValue(e.Hash), "inline": true},
+	}
+	if e.Details != "" {
+		fields = append(fields, map[string]any{"name": "Details", "value": moderationEmbedValue(e.Details)})
+	}
+	if link := moderationChatContextLink(e); link != "" {
+		fields = append(fields, map[string]any{"name": "Chat context", "value": moderationEmbedValue(link)})
+	}
+	return map[string]any{
+		"username": cfg.GetDString("Backend", "moderationNotifications", "username"),
+		"embeds": []map[string]any{{
+			"title":     "Moderation event: " + e.Kind,
+			"fields":    fields,
+			"timestamp": e.When.Format(time.RFC3339),
+		}},
+	}
+}
+
+// empty if "chatLinkFormat" is not configured
+func moderationChatContextLink(e moderationEvent) string {
+	linkFmt := cfg.GetDString("", "moderationNotifications", "chatLinkFormat")
+	if linkFmt == "" {
+		return ""
+	}
+	return strings.NewReplacer(
+		"{instance}", fmt.Sprint(e.InstanceID),
+		"{hash}", e.Hash,
+		"{ip}", e.IP,
+		"{time}", fmt.Sprint(e.When.Unix()),
+		"{event}", e.EventID,
+	).Replace(linkFmt)
+}
+
+func pubkeyHash(pubkey []byte) string {
+	h := sha256.Sum256(pubkey)
+	return hex.EncodeToString(h[:])
+}
+
+func pubkeyB64Hash(pubkeyB64 string) string {
+	pk, err := base64.StdEncoding.DecodeString(pubkeyB64)
+	if err != nil {
+		log.Printf("Failed to decode base64 pubkey %q: %s", pubkeyB64, err.Error())
+		return ""
+	}
+	return pubkeyHash(pk)
+}
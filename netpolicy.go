@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"slices"
+	"strings"
+
+	"github.com/maxsupermanhd/lac/v2"
+)
+
+// per queue "networkPolicy":
+// "allowedCountries", "allowedContinents" - ISO codes, empty allows everyone,
+// "deniedCountries" - ISO codes rejected even if continent is allowed,
+// "linkedOnlyHosting", "linkedOnlyMobile" - such networks need linked identity
+// unknown country is never rejected so lookup outage does not lock out players
+
+func networkPolicyAllowsLocation(cfgs []lac.Conf, country, continent string) bool {
+	if country == "" {
+		return true
+	}
+	denied := tryCfgGetD(tryGetSliceStringGen("networkPolicy", "deniedCountries"), []string{}, cfgs...)
+	if slices.ContainsFunc(denied, func(s string) bool { return strings.EqualFold(s, country) }) {
+		return false
+	}
+	countries := tryCfgGetD(tryGetSliceStringGen("networkPolicy", "allowedCountries"), []string{}, cfgs...)
+	continents := tryCfgGetD(tryGetSliceStringGen("networkPolicy", "allowedContinents"), []string{}, cfgs...)
+	if len(countries) == 0 && len(continents) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(countries, func(s string) bool { return strings.EqualFold(s, country) }) ||
+		slices.ContainsFunc(continents, func(s string) bool { return strings.EqualFold(s, continent) })
+}
+
+func networkPolicyHasLocation(cfgs []lac.Conf) bool {
+	for _, k := range []string{"allowedCountries", "allowedContinents", "deniedCountries"} {
+		if len(tryCfgGetD(tryGetSliceStringGen("networkPolicy", k), []string{}, cfgs...)) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// lookup can wait up to "lookupTimeoutMilliseconds", only done when policy
+// has something to check for this player
+func joinRuleNetwork(c *joinCheckContext) joinCheckVerdict {
+	location := networkPolicyHasLocation(c.inst.cfgs)
+	linkedOnlyHosting := tryCfgGetD(tryGetBoolGen("networkPolicy", "linkedOnlyHosting"), false, c.inst.cfgs...)
+	linkedOnlyMobile := tryCfgGetD(tryGetBoolGen("networkPolicy", "linkedOnlyMobile"), false, c.inst.cfgs...)
+	linkedOnly := c.account == nil && (linkedOnlyHosting || linkedOnlyMobile)
+	if !location && !linkedOnly {
+		return joinCheckVerdict{}
+	}
+	rsp, err := c.isp()
+	if err != nil {
+		c.input("error", err.Error())
+		return joinCheckVerdict{}
+	}
+	c.input("provider", rsp.Provider)
+	c.input("country", rsp.Country)
+	c.input("continent", rsp.Continent)
+	c.input("isp", rsp.ISP)
+	c.input("org", rsp.Org)
+	c.input("mobile", rsp.Mobile)
+	c.input("hosting", rsp.Hosting)
+	if !networkPolicyAllowsLocation(c.inst.cfgs, rsp.Country, rsp.Continent) {
+		allowed := slices.Concat(
+			tryCfgGetD(tryGetSliceStringGen("networkPolicy", "allowedCountries"), []string{}, c.inst.cfgs...),
+			tryCfgGetD(tryGetSliceStringGen("networkPolicy", "allowedContinents"), []string{}, c.inst.cfgs...))
+		return joinCheckVerdict{
+			fired:  true,
+			action: joinCheckActionLevelReject,
+			reason: c.msg("reject.region", "country", rsp.Country, "allowed", strings.Join(allowed, ", ")),
+		}
+	}
+	if !linkedOnly {
+		return joinCheckVerdict{}
+	}
+	var network string
+	switch {
+	case rsp.Hosting && linkedOnlyHosting:
+		network = "hosting"
+	case rsp.Mobile && linkedOnlyMobile:
+		network = "mobile"
+	default:
+		return joinCheckVerdict{}
+	}
+	return joinCheckVerdict{
+		fired:  true,
+		action: joinCheckActionLevelReject,
+		reason: c.msg("reject.netNonLinked", "network", network),
+	}
+}
+
+// adds "country" to players of room status before it is published, only
+// from lookup cache so players nobody looked up stay without it, never waits,
+// returns content as is if there is nothing to add
+func roomStatusAnnotateCountries(content []byte) []byte {
+	var status map[string]any
+	d := json.NewDecoder(bytes.NewReader(content))
+	d.UseNumber()
+	if d.Decode(&status) != nil {
+		return content
+	}
+	pl, _ := status["players"].([]any)
+	annotated := false
+	for _, v := range pl {
+		p, ok := v.(map[string]any)
+		if !ok {
+			continue
+		}
+		ip, _ := p["ip"].(string)
+		if ip == "" {
+			continue
+		}
+		if rsp, ok := ISPchecker.Cached(ip); ok {
+			p["country"] = rsp.Country
+			annotated = true
+		}
+	}
+	if !annotated {
+		return content
+	}
+	b, err := json.Marshal(status)
+	if err != nil {
+		return content
+	}
+	return b
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"testing"
+
+	"autohoster-backend/ispcheck"
+
+	"github.com/maxsupermanhd/lac/v2"
+)
+
+func TestNetworkPolicyAllowsLocation(t *testing.T) {
+	tests := []struct {
+		policy    map[string]any
+		country   string
+		continent string
+		want      bool
+	}{
+		{nil, "DE", "EU", true},
+		{map[string]any{"allowedCountries": []any{"de"}}, "DE", "EU", true},
+		{map[string]any{"allowedCountries": []any{"DE"}}, "FR", "EU", false},
+		{map[string]any{"allowedCountries": []any{"DE"}}, "", "", true},
+		{map[string]any{"allowedContinents": []any{"EU"}}, "FR", "EU", true},
+		{map[string]any{"allowedContinents": []any{"EU"}, "deniedCountries": []any{"FR"}}, "FR", "EU", false},
+		{map[string]any{"deniedCountries": []any{"FR"}}, "US", "NA", true},
+	}
+	for i, tt := range tests {
+		c := lac.NewConf()
+		if tt.policy != nil {
+			c.Set(tt.policy, "networkPolicy")
+		}
+		if got := networkPolicyAllowsLocation([]lac.Conf{c}, tt.country, tt.continent); got != tt.want {
+			t.Errorf("%d: networkPolicyAllowsLocation(%q, %q) = %v, want %v", i, tt.country, tt.continent, got, tt.want)
+		}
+	}
+}
+
+func TestJoinRuleNetwork(t *testing.T) {
+	account := 1
+	hosting := &ispcheck.LookupResponse{Provider: "ipapi", Country: "DE", Continent: "EU", Hosting: true}
+	tests := []struct {
+		name    string
+		policy  map[string]any
+		account *int
+		looked  bool
+		fired   bool
+	}{
+		{"no policy", nil, nil, false, false},
+		{"linked only for linked player", map[string]any{"linkedOnlyHosting": true}, &account, false, false},
+		{"linked only hosting", map[string]any{"linkedOnlyHosting": true}, nil, true, true},
+		{"linked only mobile", map[string]any{"linkedOnlyMobile": true}, nil, true, false},
+		{"location for linked player", map[string]any{"allowedCountries": []any{"FR"}}, &account, true, true},
+		{"location allowed", map[string]any{"deniedCountries": []any{"FR"}}, nil, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := lac.NewConf()
+			if tt.policy != nil {
+				cfg.Set(tt.policy, "networkPolicy")
+			}
+			c := &joinCheckContext{
+				inst:      testJoinCheckInstance(cfg),
+				account:   tt.account,
+				inputs:    map[string]any{},
+				ispLooked: true,
+				ispRsp:    hosting,
+			}
+			v := joinRuleNetwork(c)
+			if _, looked := c.inputs["provider"]; looked != tt.looked {
+				t.Errorf("looked up %v, want %v", looked, tt.looked)
+			}
+			if v.fired != tt.fired {
+				t.Errorf("fired %v, want %v", v.fired, tt.fired)
+			}
+		})
+	}
+}
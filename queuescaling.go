@@ -0,0 +1,118 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// queue scaling is configured per queue:
+// "minLobbyRooms"/"maxLobbyRooms" bound concurrent lobby rooms (default 1),
+// "maxRunningRooms" caps rooms in game and overrides global spawnCutoutRunningRooms,
+// "scaling.fastFillSeconds" and "scaling.fastFillStreak" define how many quick
+// fills in a row are needed to add one more lobby room, fill also counts as
+// quick when players waited in the room less than "scaling.fastWaitSeconds"
+// on average (room can sit empty for a while before a rush of players)
+
+type queueDemandStats struct {
+	LastFills []time.Duration
+	LastWaits []time.Duration
+	Streak    int
+	LastFill  time.Time
+}
+
+// runs in runner loop, remembers when player first showed up in queue lobby
+func queueDemandRecordJoin(inst *instance, pubkeyB64 string) {
+	if inst.Origin != "queue" || instanceState(inst.state.Load()) > instanceStateInLobby {
+		return
+	}
+	if _, ok := inst.lobbyJoinTimes[pubkeyB64]; !ok {
+		inst.lobbyJoinTimes[pubkeyB64] = time.Now()
+	}
+}
+
+// average time players of the room spent in lobby until it filled
+func queueDemandAverageWait(inst *instance) time.Duration {
+	total := time.Duration(0)
+	n := 0
+	for _, p := range roomStatusPlayersOfType(inst.RoomStatus, "player") {
+		pk, _ := p["pk"].(string)
+		joined, ok := inst.lobbyJoinTimes[pk]
+		if !ok {
+			continue
+		}
+		total += time.Since(joined)
+		n++
+	}
+	if n == 0 {
+		return 0
+	}
+	return total / time.Duration(n)
+}
+
+var (
+	queueDemandLock sync.Mutex
+	queueDemand     = map[string]*queueDemandStats{}
+)
+
+// called when queue room leaves the lobby, instance id is its creation time
+func queueDemandRecordFill(inst *instance) {
+	if inst.Origin != "queue" || inst.QueueName == "" {
+		return
+	}
+	took := time.Since(time.Unix(inst.Id, 0))
+	wait := queueDemandAverageWait(inst)
+	fast := time.Duration(cfg.GetDInt(120, "queues", inst.QueueName, "scaling", "fastFillSeconds")) * time.Second
+	fastWait := time.Duration(cfg.GetDInt(60, "queues", inst.QueueName, "scaling", "fastWaitSeconds")) * time.Second
+	queueDemandLock.Lock()
+	defer queueDemandLock.Unlock()
+	s, ok := queueDemand[inst.QueueName]
+	if !ok {
+		s = &queueDemandStats{}
+		queueDemand[inst.QueueName] = s
+	}
+	s.LastFills = append(s.LastFills, took)
+	if len(s.LastFills) > 10 {
+		s.LastFills = s.LastFills[1:]
+	}
+	s.LastWaits = append(s.LastWaits, wait)
+	if len(s.LastWaits) > 10 {
+		s.LastWaits = s.LastWaits[1:]
+	}
+	s.LastFill = time.Now()
+	if took < fast || (wait > 0 && wait < fastWait) {
+		s.Streak++
+	} else {
+		s.Streak = 0
+	}
+	inst.logger.Printf("Queue %q room filled in %s, players waited %s on average (fast fill streak %d)",
+		inst.QueueName, took.Round(time.Second), wait.Round(time.Second), s.Streak)
+}
+
+// desired lobby room count grows by one for every streak of fast fills and
+// falls back to minimum once queue goes quiet
+func queueDesiredLobbyRooms(queueName string) int {
+	minRooms := max(cfg.GetDInt(1, "queues", queueName, "minLobbyRooms"), 0)
+	maxRooms := max(cfg.GetDInt(1, "queues", queueName, "maxLobbyRooms"), minRooms)
+	streakNeeded := max(cfg.GetDInt(3, "queues", queueName, "scaling", "fastFillStreak"), 1)
+	quiet := time.Duration(cfg.GetDInt(600, "queues", queueName, "scaling", "quietSeconds")) * time.Second
+	queueDemandLock.Lock()
+	defer queueDemandLock.Unlock()
+	s, ok := queueDemand[queueName]
+	if !ok {
+		return minRooms
+	}
+	if time.Since(s.LastFill) > quiet {
+		s.Streak = 0
+	}
+	return min(minRooms+s.Streak/streakNeeded, maxRooms)
+}
+
+func queueDemandSnapshot() map[string]queueDemandStats {
+	queueDemandLock.Lock()
+	defer queueDemandLock.Unlock()
+	ret := map[string]queueDemandStats{}
+	for k, v := range queueDemand {
+		ret[k] = *v
+	}
+	return ret
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	gamereport "autohoster-backend/gameReport"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/jackc/pgx/v4"
+)
+
+type ratingParticipant struct {
+	Position int
+	Team     int
+	Usertype string
+	Identity int
+	Account  *int
+	Leaver   bool
+	Rating   float64
+	Games    int
+	Delta    float64
+	Result   int // 1 win 0 loss
+}
+
+func ratingGetInitial(category int) float64 {
+	return float64(cfg.GetDInt(1400, "ratings", fmt.Sprint(category), "initial"))
+}
+
+func ratingGetKFactor(category int) float64 {
+	return float64(cfg.GetDInt(32, "ratings", fmt.Sprint(category), "kFactor"))
+}
+
+// called after game was finalized in the database
+func ratingProcessGame(inst *instance, report gamereport.GameReportExtended) {
+	if len(inst.Settings.RatingCategories) == 0 {
+		return
+	}
+	if inst.DebugTriggered {
+		inst.logger.Printf("Not calculating ratings for game %d because debug was triggered", inst.GameId)
+		return
+	}
+	minGameTime := tryCfgGetD(tryGetIntGen("ratingMinGameTime"), 60000, inst.cfgs...)
+	if report.GameTime < minGameTime {
+		inst.logger.Printf("Not calculating ratings for game %d because game time %d is less than %d", inst.GameId, report.GameTime, minGameTime)
+		return
+	}
+	ctx := context.Background()
+	for _, category := range inst.Settings.RatingCategories {
+		err := dbpool.BeginFunc(ctx, func(tx pgx.Tx) error {
+			return ratingProcessCategory(ctx, tx, inst, report, category)
+		})
+		if err != nil {
+			inst.logger.Printf("Failed to calculate ratings of category %d: %s (gid %d)", category, err.Error(), inst.GameId)
+			discordPostError("Failed to calculate ratings of category %d: %s (gid %d) (instance %d)", category, err.Error(), inst.GameId, inst.Id)
+		}
+	}
+}
+
+func ratingProcessCategory(ctx context.Context, tx pgx.Tx, inst *instance, report gamereport.GameReportExtended, category int) error {
+	// replayed or recovered game end must not be rated twice
+	var rated bool
+	err := tx.QueryRow(ctx, `select exists(select 1 from rating_history where game = $1 and category = $2)`, inst.GameId, category).Scan(&rated)
+	if err != nil {
+		return err
+	}
+	if rated {
+		inst.logger.Printf("Not calculating ratings of category %d for game %d, already rated", category, inst.GameId)
+		return nil
+	}
+	parts := []*ratingParticipant{}
+	teamHasWinner := map[int]bool{}
+	for _, v := range report.PlayerData {
+		if v.PublicKey == "" || v.Usertype == "spectator" {
+			continue
+		}
+		p := &ratingParticipant{
+			Position: v.Position,
+			Team:     v.Team,
+			Usertype: v.Usertype,
+		}
+		err := tx.QueryRow(ctx, `select p.identity, i.account from players as p join identities as i on i.id = p.identity where p.game = $1 and p.position = $2`,
+			inst.GameId, v.Position).Scan(&p.Identity, &p.Account)
+		if err != nil {
+			return fmt.Errorf("looking up player at position %d: %w", v.Position, err)
+		}
+		if v.Usertype == "winner" {
+			teamHasWinner[v.Team] = true
+		}
+		parts = append(parts, p)
+	}
+	if len(teamHasWinner) == 0 {
+		inst.logger.Printf("Not calculating ratings of category %d for game %d, nobody won", category, inst.GameId)
+		return nil
+	}
+	// lost while own team won means player left before the end, rest of the team
+	// keeps the victory and leaver takes the loss
+	for _, p := range parts {
+		if teamHasWinner[p.Team] {
+			p.Result = 1
+			if p.Usertype != "winner" {
+				p.Leaver = true
+				p.Result = 0
+			}
+		}
+	}
+	if len(teamHasWinner) == len(ratingTeams(parts)) {
+		inst.logger.Printf("Not calculating ratings of category %d for game %d, everybody won", category, inst.GameId)
+		return nil
+	}
+
+	// identity rated before linking has its own row, account row wins
+	// and identity row is only used to start account rating from
+	for _, p := range parts {
+		err := tx.QueryRow(ctx, `select rating, games from ratings
+where category = $1 and ((account is not null and account = $2) or (account is null and identity = $3))
+order by account nulls last
+limit 1
+for update`, category, p.Account, p.Identity).Scan(&p.Rating, &p.Games)
+		if errors.Is(err, pgx.ErrNoRows) {
+			p.Rating = ratingGetInitial(category)
+			p.Games = 0
+		} else if err != nil {
+			return err
+		}
+	}
+
+	ratingEloCalculate(parts, ratingGetKFactor(category))
+
+	for _, p := range parts {
+		wins := p.Result
+		losses := 1 - p.Result
+		// delta is added to stored rating in case row appeared since it was read
+		conflict := `(category, identity) where account is null`
+		if p.Account != nil {
+			conflict = `(category, account) where account is not null`
+		}
+		_, err := tx.Exec(ctx, `insert into ratings (category, identity, account, rating, games, wins, losses, updated_at) values ($1, $2, $3, $4, 1, $5, $6, now())
+on conflict `+conflict+` do update set rating = ratings.rating + $7, games = ratings.games + 1, wins = ratings.wins + excluded.wins, losses = ratings.losses + excluded.losses, updated_at = now()`,
+			category, p.Identity, p.Account, p.Rating+p.Delta, wins, losses, p.Delta)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, `insert into rating_history (game, category, identity, account, rating_before, rating_after, leaver) values ($1, $2, $3, $4, $5, $6, $7)`,
+			inst.GameId, category, p.Identity, p.Account, p.Rating, p.Rating+p.Delta, p.Leaver)
+		if err != nil {
+			return err
+		}
+	}
+	inst.logger.Printf("Calculated ratings of category %d for game %d (%d players)", category, inst.GameId, len(parts))
+	return nil
+}
+
+func ratingTeams(parts []*ratingParticipant) map[int][]*ratingParticipant {
+	teams := map[int][]*ratingParticipant{}
+	for _, p := range parts {
+		teams[p.Team] = append(teams[p.Team], p)
+	}
+	return teams
+}
+
+func ratingTeamAverage(team []*ratingParticipant) float64 {
+	sum := 0.0
+	for _, p := range team {
+		sum += p.Rating
+	}
+	return sum / float64(len(team))
+}
+
+func ratingEloExpected(a, b float64) float64 {
+	return 1 / (1 + math.Pow(10, (b-a)/400))
+}
+
+// every team is matched against every other team with different outcome,
+// team rating is average of its players
+func ratingEloCalculate(parts []*ratingParticipant, k float64) {
+	teams := ratingTeams(parts)
+	for ta, playersA := range teams {
+		ra := ratingTeamAverage(playersA)
+		opponents := 0
+		teamDelta := 0.0
+		teamWon := false
+		for _, p := range playersA {
+			if p.Result == 1 {
+				teamWon = true
+			}
+		}
+		for tb, playersB := range teams {
+			if ta == tb {
+				continue
+			}
+			opponentWon := false
+			for _, p := range playersB {
+				if p.Result == 1 {
+					opponentWon = true
+				}
+			}
+			if teamWon == opponentWon {
+				continue
+			}
+			score := 0.0
+			if teamWon {
+				score = 1.0
+			}
+			teamDelta += k * (score - ratingEloExpected(ra, ratingTeamAverage(playersB)))
+			opponents++
+		}
+		if opponents == 0 {
+			continue
+		}
+		teamDelta /= float64(opponents)
+		for _, p := range playersA {
+			p.Delta = teamDelta
+			if p.Leaver {
+				// leavers are only found in winning teams, they get the
+				// same expectation but with a loss instead
+				p.Delta = teamDelta - k
+			}
+		}
+	}
+}
+
+func ratingLookup(category int, pubkey []byte) (float64, bool) {
+	var rating float64
+	err := dbpool.QueryRow(context.Background(), `select r.rating from ratings as r
+join identities as i on (i.account is not null and r.account = i.account) or (i.account is null and r.account is null and r.identity = i.id)
+where r.category = $1 and i.hash = encode(sha256($2), 'hex')
+limit 1`, category, pubkey).Scan(&rating)
+	if err != nil {
+		return ratingGetInitial(category), false
+	}
+	return rating, true
+}
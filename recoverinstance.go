@@ -13,6 +13,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/maxsupermanhd/lac/v2"
 )
@@ -187,6 +188,9 @@ func recoverLoad(p string) (*instance, error) {
 		RoomStatus:     lac.NewConf(),
 		pokeRequests:   make(chan int, 20),
 		pokeCancels:    make(chan string, 20),
+		readyPlayers:   map[string]int{},
+		playerLangs:    map[string]string{},
+		lobbyJoinTimes: map[string]time.Time{},
 	}
 	d := json.NewDecoder(bytes.NewReader(b))
 	d.UseNumber()
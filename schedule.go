@@ -0,0 +1,326 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// schedules are configured as "schedules.<name>" with either "cron" (5 fields,
+// minute hour day-of-month month day-of-week) or "at" (RFC3339) and an action:
+// "spawn" creates a room from "queue" preset with optional "settings" overrides,
+// "enable"/"disable" toggle "queues" for "durationMinutes"
+
+type scheduleQueueOverride struct {
+	Disabled bool
+	Until    time.Time
+	Schedule string
+}
+
+type cronField struct {
+	any    bool
+	values map[int]bool
+}
+
+type cronSchedule struct {
+	minute, hour, dom, month, dow cronField
+}
+
+var (
+	scheduleLock           sync.Mutex
+	scheduleQueueOverrides = map[string]scheduleQueueOverride{}
+	scheduleRooms          = map[string]int64{}
+
+	errCronFieldCount = errors.New("cron expression must have 5 fields")
+)
+
+func isQueueDisabled(queueName string) bool {
+	scheduleLock.Lock()
+	o, ok := scheduleQueueOverrides[queueName]
+	scheduleLock.Unlock()
+	if ok && time.Now().Before(o.Until) {
+		return o.Disabled
+	}
+	return cfg.GetDSBool(false, "queues", queueName, "disabled")
+}
+
+func parseCronField(f string, lo, hi int) (cronField, error) {
+	ret := cronField{values: map[int]bool{}}
+	if f == "*" {
+		ret.any = true
+		return ret, nil
+	}
+	for _, part := range strings.Split(f, ",") {
+		rng, stepStr, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepStr)
+			if err != nil || step <= 0 {
+				return ret, fmt.Errorf("invalid step %q", stepStr)
+			}
+		}
+		from, to := lo, hi
+		if rng != "*" {
+			fromStr, toStr, isRange := strings.Cut(rng, "-")
+			var err error
+			from, err = strconv.Atoi(fromStr)
+			if err != nil {
+				return ret, fmt.Errorf("invalid value %q", fromStr)
+			}
+			to = from
+			if isRange {
+				to, err = strconv.Atoi(toStr)
+				if err != nil {
+					return ret, fmt.Errorf("invalid value %q", toStr)
+				}
+			} else if hasStep {
+				to = hi
+			}
+		}
+		if from < lo || to > hi || from > to {
+			return ret, fmt.Errorf("value %q out of range %d-%d", part, lo, hi)
+		}
+		for v := from; v <= to; v += step {
+			ret.values[v] = true
+		}
+	}
+	return ret, nil
+}
+
+func parseCron(expr string) (*cronSchedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, errCronFieldCount
+	}
+	ret := &cronSchedule{}
+	var err error
+	for i, f := range []struct {
+		dst    *cronField
+		lo, hi int
+	}{{&ret.minute, 0, 59}, {&ret.hour, 0, 23}, {&ret.dom, 1, 31}, {&ret.month, 1, 12}, {&ret.dow, 0, 7}} {
+		*f.dst, err = parseCronField(fields[i], f.lo, f.hi)
+		if err != nil {
+			return nil, fmt.Errorf("field %d: %w", i+1, err)
+		}
+	}
+	if ret.dow.values[7] {
+		ret.dow.values[0] = true
+	}
+	return ret, nil
+}
+
+func (f cronField) match(v int) bool {
+	return f.any || f.values[v]
+}
+
+// day of month and day of week are OR'ed when both are restricted, same as cron
+func (c *cronSchedule) matchDay(t time.Time) bool {
+	if !c.dom.any && !c.dow.any {
+		return c.dom.match(t.Day()) || c.dow.match(int(t.Weekday()))
+	}
+	return c.dom.match(t.Day()) && c.dow.match(int(t.Weekday()))
+}
+
+// skips whole months, days and hours that can not match
+func (c *cronSchedule) next(after time.Time) (time.Time, bool) {
+	loc := after.Location()
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case !c.month.match(int(t.Month())):
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !c.matchDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		case !c.hour.match(t.Hour()):
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+		case !c.minute.match(t.Minute()):
+			t = t.Add(time.Minute)
+		default:
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func scheduleLocation() *time.Location {
+	loc, err := time.LoadLocation(cfg.GetDString("UTC", "schedulesTimezone"))
+	if err != nil {
+		log.Printf("Failed to load schedules timezone: %s", err.Error())
+		return time.UTC
+	}
+	return loc
+}
+
+// returns whether schedule named s should fire in (from, to]
+func scheduleDue(s string, from, to time.Time) (bool, error) {
+	if at, ok := cfg.GetString("schedules", s, "at"); ok {
+		t, err := time.Parse(time.RFC3339, at)
+		if err != nil {
+			return false, err
+		}
+		return t.After(from) && !t.After(to), nil
+	}
+	expr, ok := cfg.GetString("schedules", s, "cron")
+	if !ok {
+		return false, errors.New("neither cron nor at defined")
+	}
+	c, err := parseCron(expr)
+	if err != nil {
+		return false, err
+	}
+	loc := scheduleLocation()
+	n, ok := c.next(from.In(loc))
+	return ok && !n.After(to), nil
+}
+
+func routineSchedules(closechan <-chan struct{}) {
+	lastChecked := time.Now()
+	for {
+		select {
+		case <-closechan:
+			return
+		case <-time.After(time.Duration(cfg.GetDInt(15, "schedulesPollInterval")) * time.Second):
+		}
+		now := time.Now()
+		schedules, _ := cfg.GetKeys("schedules")
+		sort.Strings(schedules)
+		for _, s := range schedules {
+			if cfg.GetDBool(false, "schedules", s, "disabled") {
+				continue
+			}
+			due, err := scheduleDue(s, lastChecked, now)
+			if err != nil {
+				log.Printf("Schedule %q is invalid: %s", s, err.Error())
+				continue
+			}
+			if due {
+				scheduleFire(s)
+			}
+		}
+		lastChecked = now
+	}
+}
+
+func scheduleFire(s string) {
+	action := cfg.GetDString("spawn", "schedules", s, "action")
+	log.Printf("Schedule %q fired (%s)", s, action)
+	switch action {
+	case "spawn":
+		if !cfg.GetDSBool(false, "allowSpawn") {
+			log.Printf("Schedule %q skipped, room spawning disabled", s)
+			return
+		}
+		// scheduled rooms have no queue to clean them up, so schedule
+		// waits until its previous room starts or goes away
+		if scheduleRoomInLobby(s) {
+			log.Printf("Schedule %q skipped, previous room is still in lobby", s)
+			return
+		}
+		queueName := cfg.GetDString("", "schedules", s, "queue")
+		c := cfg.DupSubTree("queues", queueName)
+		if _, ok := c.GetKeys(); !ok || queueName == "" {
+			log.Printf("Schedule %q has no valid queue preset", s)
+			return
+		}
+		settings, _ := cfg.GetMapStringAny("schedules", s, "settings")
+		for k, v := range settings {
+			c.Set(v, k)
+		}
+		gi, err := generateInstance(c, queueName)
+		if err != nil {
+			log.Printf("Schedule %q failed to generate instance: %s", s, err.Error())
+			giid := int64(-1)
+			if gi != nil {
+				giid = gi.Id
+				releaseInstance(gi)
+			}
+			discordPostError("%s Schedule %q failed to generate instance %d: %s", time.Now(), s, giid, err.Error())
+			return
+		}
+		gi.QueueName = ""
+		gi.Origin = "scheduled"
+		scheduleLock.Lock()
+		scheduleRooms[s] = gi.Id
+		scheduleLock.Unlock()
+		log.Printf("Schedule %q spawned instance %d (%s)", s, gi.Id, instanceJoinAddress(gi))
+		go spawnRunner(gi)
+	case "enable", "disable":
+		until := time.Now().Add(time.Duration(cfg.GetDInt(60, "schedules", s, "durationMinutes")) * time.Minute)
+		scheduleLock.Lock()
+		for _, q := range cfg.GetDSliceString([]string{}, "schedules", s, "queues") {
+			scheduleQueueOverrides[q] = scheduleQueueOverride{
+				Disabled: action == "disable",
+				Until:    until,
+				Schedule: s,
+			}
+		}
+		scheduleLock.Unlock()
+	default:
+		log.Printf("Schedule %q has unknown action %q", s, action)
+	}
+}
+
+func scheduleRoomInLobby(s string) bool {
+	scheduleLock.Lock()
+	id, ok := scheduleRooms[s]
+	scheduleLock.Unlock()
+	if !ok {
+		return false
+	}
+	instancesLock.Lock()
+	defer instancesLock.Unlock()
+	for _, inst := range instances {
+		if inst.Id == id {
+			return instanceState(inst.state.Load()) <= instanceStateInLobby
+		}
+	}
+	return false
+}
+
+func webHandleSchedules(w http.ResponseWriter, r *http.Request) {
+	type scheduleStatus struct {
+		Action string
+		Next   *time.Time `json:",omitempty"`
+		Error  string     `json:",omitempty"`
+	}
+	ret := map[string]any{}
+	statuses := map[string]scheduleStatus{}
+	schedules, _ := cfg.GetKeys("schedules")
+	loc := scheduleLocation()
+	now := time.Now()
+	for _, s := range schedules {
+		st := scheduleStatus{Action: cfg.GetDString("spawn", "schedules", s, "action")}
+		if at, ok := cfg.GetString("schedules", s, "at"); ok {
+			t, err := time.Parse(time.RFC3339, at)
+			if err != nil {
+				st.Error = err.Error()
+			} else if t.After(now) {
+				st.Next = &t
+			}
+		} else if c, err := parseCron(cfg.GetDString("", "schedules", s, "cron")); err != nil {
+			st.Error = err.Error()
+		} else if n, ok := c.next(now.In(loc)); ok {
+			st.Next = &n
+		}
+		statuses[s] = st
+	}
+	ret["schedules"] = statuses
+	scheduleLock.Lock()
+	overrides := map[string]scheduleQueueOverride{}
+	for k, v := range scheduleQueueOverrides {
+		if now.Before(v.Until) {
+			overrides[k] = v
+		}
+	}
+	scheduleLock.Unlock()
+	ret["queueOverrides"] = overrides
+	webRespondJSON(w, ret)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	tests := []struct {
+		expr string
+		ok   bool
+	}{
+		{"* * * * *", true},
+		{"0 12 * * 1-5", true},
+		{"*/15 0-6/2 1,15 * 7", true},
+		{"30 4 29 2 *", true},
+		{"5/10 * * * *", true},
+		{"* * * *", false},
+		{"* * * * * *", false},
+		{"60 * * * *", false},
+		{"* 24 * * *", false},
+		{"* * 0 * *", false},
+		{"* * * 13 *", false},
+		{"* * * * 8", false},
+		{"5-1 * * * *", false},
+		{"*/0 * * * *", false},
+		{"a * * * *", false},
+	}
+	for _, tt := range tests {
+		_, err := parseCron(tt.expr)
+		if (err == nil) != tt.ok {
+			t.Errorf("parseCron(%q) error %v, expected ok %v", tt.expr, err, tt.ok)
+		}
+	}
+}
+
+func TestCronFields(t *testing.T) {
+	c, err := parseCron("5/20 */6 * * 7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range []int{5, 25, 45} {
+		if !c.minute.match(m) {
+			t.Errorf("minute %d does not match", m)
+		}
+	}
+	if c.minute.match(0) || c.minute.match(6) {
+		t.Errorf("unexpected minutes match")
+	}
+	if !c.hour.match(18) || c.hour.match(19) {
+		t.Errorf("hours step is wrong")
+	}
+	if !c.dow.match(0) {
+		t.Errorf("day of week 7 is not sunday")
+	}
+}
+
+// checks next() against minute by minute search
+func TestCronNext(t *testing.T) {
+	exprs := []string{
+		"* * * * *",
+		"0 0 * * *",
+		"*/7 3 * * *",
+		"30 12 1 * *",
+		"0 9 * * 1-5",
+		"15 10 13 * 5",
+		"0 0 29 2 *",
+		"59 23 31 12 *",
+		"0 */6 * 1,7 0",
+	}
+	starts := []time.Time{
+		time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2026, 2, 28, 23, 59, 30, 0, time.UTC),
+		time.Date(2027, 12, 31, 23, 59, 0, 0, time.UTC),
+		time.Date(2026, 6, 15, 12, 30, 0, 0, time.UTC),
+	}
+	for _, expr := range exprs {
+		c, err := parseCron(expr)
+		if err != nil {
+			t.Fatalf("parseCron(%q): %s", expr, err.Error())
+		}
+		for _, start := range starts {
+			got, ok := c.next(start)
+			if !ok {
+				t.Errorf("%q after %s: no next time", expr, start)
+				continue
+			}
+			want := start.Truncate(time.Minute).Add(time.Minute)
+			for !(c.month.match(int(want.Month())) && c.matchDay(want) && c.hour.match(want.Hour()) && c.minute.match(want.Minute())) {
+				want = want.Add(time.Minute)
+			}
+			if !got.Equal(want) {
+				t.Errorf("%q after %s: got %s, want %s", expr, start, got, want)
+			}
+		}
+	}
+}
+
+func TestCronNextImpossible(t *testing.T) {
+	c, err := parseCron("0 0 31 2 *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, ok := c.next(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)); ok {
+		t.Errorf("february 31st matched %s", n)
+	}
+}
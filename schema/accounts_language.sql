@@ -0,0 +1 @@
+alter table accounts add column if not exists language text;
@@ -0,0 +1 @@
+alter table bans add column if not exists issuer text not null default '';
@@ -0,0 +1,13 @@
+-- network is /32 or /128 for single address bans
+create table if not exists ip_bans (
+	id               serial primary key,
+	network          cidr not null,
+	reason           text not null,
+	issuer           text not null default '',
+	time_issued      timestamptz not null default now(),
+	time_expires     timestamptz,
+	forbids_joining  bool not null default false,
+	forbids_playing  bool not null default false,
+	forbids_chatting bool not null default false
+);
+create index if not exists ip_bans_network on ip_bans using gist (network inet_ops);
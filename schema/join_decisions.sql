@@ -0,0 +1,19 @@
+create table if not exists join_decisions (
+	id           serial primary key,
+	instance     bigint not null,
+	identity     int references identities(id),
+	hash         text not null,
+	account      int references accounts(id),
+	ip           text not null,
+	name         text not null,
+	action       text not null,
+	reason       text not null default '',
+	messages     text[] not null default '{}',
+	rules_fired  text[] not null default '{}',
+	trace        jsonb not null default '[]',
+	latency_ms   int not null default 0,
+	when_decided timestamptz not null default now()
+);
+create index if not exists join_decisions_hash on join_decisions (hash, id desc);
+create index if not exists join_decisions_account on join_decisions (account, id desc) where account is not null;
+create index if not exists join_decisions_ip on join_decisions (ip, id desc);
@@ -0,0 +1,8 @@
+-- not applied on startup, run by hand with psql outside of a transaction
+-- before enabling evasion rule, without it rule scans whole chatlog
+--
+-- building concurrently does not lock chat logging but leaves an INVALID
+-- index behind if it fails or gets interrupted, backend reports that on
+-- startup, drop it and run this again:
+--   drop index concurrently if exists chatlog_ip_inet;
+create index concurrently if not exists chatlog_ip_inet on chatlog using gist ((ip::inet) inet_ops);
@@ -0,0 +1,29 @@
+-- ratings are kept per account, identities without account are rated on their own
+create table if not exists ratings (
+	id         serial primary key,
+	category   int not null,
+	identity   int not null references identities(id),
+	account    int references accounts(id),
+	rating     double precision not null,
+	games      int not null default 0,
+	wins       int not null default 0,
+	losses     int not null default 0,
+	updated_at timestamptz not null default now()
+);
+create unique index if not exists ratings_category_account on ratings (category, account) where account is not null;
+create unique index if not exists ratings_category_identity on ratings (category, identity) where account is null;
+
+create table if not exists rating_history (
+	id            serial primary key,
+	game          bigint not null,
+	category      int not null,
+	identity      int not null references identities(id),
+	account       int references accounts(id),
+	rating_before double precision not null,
+	rating_after  double precision not null,
+	leaver        bool not null default false,
+	when_rated    timestamptz not null default now()
+);
+create index if not exists rating_history_game on rating_history (game);
+create unique index if not exists rating_history_game_category_identity on rating_history (game, category, identity);
+create index if not exists rating_history_identity on rating_history (identity);
@@ -0,0 +1,26 @@
+-- whole bracket state lives in data, standings and matches are kept for the website
+create table if not exists tournaments (
+	id         serial primary key,
+	name       text not null,
+	format     text not null,
+	data       jsonb not null,
+	standings  jsonb,
+	finished   bool not null default false,
+	created_at timestamptz not null default now(),
+	updated_at timestamptz not null default now()
+);
+create index if not exists tournaments_unfinished on tournaments (id) where not finished;
+
+create table if not exists tournament_matches (
+	tournament  int not null references tournaments(id),
+	match       int not null,
+	bracket     text not null,
+	round       int not null,
+	team_a      text not null,
+	team_b      text not null,
+	winner      text not null,
+	instance    bigint not null,
+	game        int not null,
+	finished_at timestamptz not null,
+	primary key (tournament, match)
+);
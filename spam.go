@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	"maps"
 	"slices"
 	"sync"
@@ -34,7 +35,7 @@ func chatSpamIsMuted(inst *instance, ip string) bool {
 	return ok
 }
 
-func chatSpamHit(inst *instance, content, ip, key64 string) {
+func chatSpamHit(inst *instance, content, ip, key64, name, hash string) {
 	tWindowDur := time.Duration(tryCfgGetD(tryGetIntGen("antiSpamWindowSeconds"), 3, inst.cfgs...)) * time.Second
 	tWindowHits := tryCfgGetD(tryGetIntGen("antiSpamWindowHits"), 4, inst.cfgs...)
 
@@ -83,14 +84,15 @@ func chatSpamHit(inst *instance, content, ip, key64 string) {
 	}
 
 	if hits >= tWindowHits {
-		_, err := DbLogAction("%d [spam] anti-spam on ip %s", inst.Id, ip)
+		ecode, err := DbLogAction("%d [spam] anti-spam on ip %s", inst.Id, ip)
 		if err != nil {
 			inst.logger.Printf("Failed to log action in database: %s", err.Error())
 		}
+		moderationNotify(inst, "spam", name, hash, ip, ecode, fmt.Sprintf("Muted for %d spam messages within %s", hits, tWindowDur))
 		chatSpamMutes[ip] = time.Now()
 		instWriteFmt(inst, `set chat mute %s`, key64)
-		instWriteFmt(inst, `chat direct %s %s`, key64, "⚠ You were automatically muted for chat spam.")
-		instWriteFmt(inst, `chat bcast ⚠ Please do not spam, it does not help anyone. Become moderator instead and kick out afk people.`)
+		instWriteFmt(inst, `chat direct %s %s`, key64, msgT(inst, msgRoomLang(inst), "spam.muted"))
+		instWriteFmt(inst, `chat bcast %s`, msgT(inst, msgRoomLang(inst), "spam.warning"))
 	}
 
 }
@@ -0,0 +1,728 @@
+package main
+
+import (
+	gamereport "autohoster-backend/gameReport"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+const (
+	tournamentTeamUnresolved = -1
+	tournamentTeamBye        = -2
+)
+
+const (
+	tournamentMatchPending  = "pending"
+	tournamentMatchReady    = "ready"
+	tournamentMatchSpawning = "spawning"
+	tournamentMatchRunning  = "running"
+	tournamentMatchFinished = "finished"
+	tournamentMatchDisputed = "disputed"
+)
+
+type tournamentTeam struct {
+	Name   string   `json:"name"`
+	Hashes []string `json:"hashes"`
+}
+
+type tournamentDefinition struct {
+	Name            string           `json:"name"`
+	Format          string           `json:"format"`
+	Queue           string           `json:"queue"`
+	Teams           []tournamentTeam `json:"teams"`
+	MapPool         []string         `json:"mapPool"`
+	Settings        map[string]any   `json:"settings"`
+	AllowSpectators bool             `json:"allowSpectators"`
+	MaxConcurrent   int              `json:"maxConcurrent"`
+}
+
+// slot is either a fixed team or an outcome of another match
+type tournamentSlot struct {
+	Team      int
+	FromMatch int
+	Take      string // "winner" or "loser", empty when team is fixed
+}
+
+type tournamentMatch struct {
+	Id       int
+	Bracket  string
+	Round    int
+	Slots    [2]tournamentSlot
+	Teams    [2]int
+	Winner   int
+	State    string
+	Map      string
+	Instance int64
+	Game     int
+	Attempts int
+	Finished time.Time
+}
+
+type tournamentStanding struct {
+	Team   string
+	Played int
+	Wins   int
+	Losses int
+}
+
+type tournament struct {
+	Id         int
+	Definition tournamentDefinition
+	Matches    []*tournamentMatch
+	Standings  []tournamentStanding
+	Champion   string
+	Finished   bool
+	Created    time.Time
+}
+
+var (
+	tournamentsLock sync.Mutex
+	tournaments     = map[int]*tournament{}
+
+	errTournamentNotFound = errors.New("tournament not found")
+	errTournamentMatch    = errors.New("match not found or can not be resolved")
+)
+
+func tournamentValidate(d tournamentDefinition) error {
+	if d.Name == "" {
+		return errors.New("tournament name is empty")
+	}
+	if _, ok := cfg.GetKeys("queues", d.Queue); !ok {
+		return fmt.Errorf("queue %q not found", d.Queue)
+	}
+	for _, m := range d.MapPool {
+		if _, ok := cfg.GetString("queues", d.Queue, "maps", m, "hash"); !ok {
+			return fmt.Errorf("map %q is not defined in queue %q", m, d.Queue)
+		}
+	}
+	minTeams := 2
+	if d.Format == "double" {
+		minTeams = 3
+	}
+	if len(d.Teams) < minTeams {
+		return fmt.Errorf("format %q needs at least %d teams", d.Format, minTeams)
+	}
+	for _, t := range d.Teams {
+		if t.Name == "" || len(t.Hashes) == 0 {
+			return errors.New("every team must have a name and at least one identity")
+		}
+	}
+	return nil
+}
+
+func tournamentBuildMatches(d tournamentDefinition) ([]*tournamentMatch, error) {
+	switch d.Format {
+	case "single":
+		m, _ := tournamentBuildElimination(len(d.Teams))
+		return m, nil
+	case "double":
+		return tournamentBuildDoubleElimination(len(d.Teams)), nil
+	case "roundrobin":
+		return tournamentBuildRoundRobin(len(d.Teams)), nil
+	}
+	return nil, fmt.Errorf("unknown tournament format %q", d.Format)
+}
+
+func tournamentNewMatch(matches []*tournamentMatch, bracket string, round int, a, b tournamentSlot) []*tournamentMatch {
+	return append(matches, &tournamentMatch{
+		Id:      len(matches),
+		Bracket: bracket,
+		Round:   round,
+		Slots:   [2]tournamentSlot{a, b},
+		Teams:   [2]int{tournamentTeamUnresolved, tournamentTeamUnresolved},
+		Winner:  tournamentTeamUnresolved,
+		State:   tournamentMatchPending,
+	})
+}
+
+func tournamentFixedSlot(team, teamCount int) tournamentSlot {
+	if team >= teamCount {
+		return tournamentSlot{Team: tournamentTeamBye}
+	}
+	return tournamentSlot{Team: team}
+}
+
+func tournamentFromSlot(match int, take string) tournamentSlot {
+	return tournamentSlot{Team: tournamentTeamUnresolved, FromMatch: match, Take: take}
+}
+
+// returns matches and ids of matches of every winners bracket round,
+// field is padded with byes to the power of two
+func tournamentBuildElimination(teamCount int) ([]*tournamentMatch, [][]int) {
+	size := 2
+	for size < teamCount {
+		size *= 2
+	}
+	matches := []*tournamentMatch{}
+	rounds := [][]int{}
+	prev := []int{}
+	for i := 0; i < size; i += 2 {
+		matches = tournamentNewMatch(matches, "winners", 1, tournamentFixedSlot(i, teamCount), tournamentFixedSlot(i+1, teamCount))
+		prev = append(prev, len(matches)-1)
+	}
+	rounds = append(rounds, prev)
+	for round := 2; len(prev) > 1; round++ {
+		next := []int{}
+		for i := 0; i < len(prev); i += 2 {
+			matches = tournamentNewMatch(matches, "winners", round, tournamentFromSlot(prev[i], "winner"), tournamentFromSlot(prev[i+1], "winner"))
+			next = append(next, len(matches)-1)
+		}
+		rounds = append(rounds, next)
+		prev = next
+	}
+	return matches, rounds
+}
+
+// losers bracket alternates between rounds where winners bracket losers drop
+// in and rounds where losers bracket survivors play each other, grand final
+// is a single match
+func tournamentBuildDoubleElimination(teamCount int) []*tournamentMatch {
+	matches, wb := tournamentBuildElimination(teamCount)
+	round := 1
+	prev := []int{}
+	for i := 0; i < len(wb[0]); i += 2 {
+		matches = tournamentNewMatch(matches, "losers", round, tournamentFromSlot(wb[0][i], "loser"), tournamentFromSlot(wb[0][i+1], "loser"))
+		prev = append(prev, len(matches)-1)
+	}
+	for r := 1; r < len(wb); r++ {
+		round++
+		dropin := []int{}
+		for i := range prev {
+			matches = tournamentNewMatch(matches, "losers", round, tournamentFromSlot(prev[i], "winner"), tournamentFromSlot(wb[r][i], "loser"))
+			dropin = append(dropin, len(matches)-1)
+		}
+		prev = dropin
+		if r == len(wb)-1 {
+			break
+		}
+		round++
+		consolidation := []int{}
+		for i := 0; i < len(prev); i += 2 {
+			matches = tournamentNewMatch(matches, "losers", round, tournamentFromSlot(prev[i], "winner"), tournamentFromSlot(prev[i+1], "winner"))
+			consolidation = append(consolidation, len(matches)-1)
+		}
+		prev = consolidation
+	}
+	wbFinal := wb[len(wb)-1][0]
+	return tournamentNewMatch(matches, "final", 1, tournamentFromSlot(wbFinal, "winner"), tournamentFromSlot(prev[0], "winner"))
+}
+
+// circle method, odd team count gets a bye that is not played at all
+func tournamentBuildRoundRobin(teamCount int) []*tournamentMatch {
+	ids := []int{}
+	for i := range teamCount {
+		ids = append(ids, i)
+	}
+	if len(ids)%2 != 0 {
+		ids = append(ids, tournamentTeamBye)
+	}
+	matches := []*tournamentMatch{}
+	n := len(ids)
+	for round := 1; round < n; round++ {
+		for i := 0; i < n/2; i++ {
+			a, b := ids[i], ids[n-1-i]
+			if a == tournamentTeamBye || b == tournamentTeamBye {
+				continue
+			}
+			matches = tournamentNewMatch(matches, "roundrobin", round, tournamentSlot{Team: a}, tournamentSlot{Team: b})
+		}
+		ids = append([]int{ids[0], ids[n-1]}, ids[1:n-1]...)
+	}
+	return matches
+}
+
+func (m *tournamentMatch) loser() int {
+	if m.Winner == m.Teams[0] {
+		return m.Teams[1]
+	}
+	return m.Teams[0]
+}
+
+// resolves slots of pending matches and passes byes through until nothing changes
+func tournamentAdvanceNOLOCK(t *tournament) {
+	for changed := true; changed; {
+		changed = false
+		for _, m := range t.Matches {
+			if m.State != tournamentMatchPending {
+				continue
+			}
+			resolved := true
+			for i, s := range m.Slots {
+				if s.Take == "" {
+					m.Teams[i] = s.Team
+					continue
+				}
+				from := t.Matches[s.FromMatch]
+				if from.State != tournamentMatchFinished {
+					resolved = false
+					continue
+				}
+				if s.Take == "winner" {
+					m.Teams[i] = from.Winner
+				} else {
+					m.Teams[i] = from.loser()
+				}
+			}
+			if !resolved {
+				continue
+			}
+			changed = true
+			if m.Teams[0] == tournamentTeamBye || m.Teams[1] == tournamentTeamBye {
+				m.Winner = m.Teams[0]
+				if m.Winner == tournamentTeamBye {
+					m.Winner = m.Teams[1]
+				}
+				m.State = tournamentMatchFinished
+				m.Finished = time.Now()
+				continue
+			}
+			m.State = tournamentMatchReady
+		}
+	}
+	t.Standings = tournamentStandingsNOLOCK(t)
+	for _, m := range t.Matches {
+		if m.State != tournamentMatchFinished {
+			return
+		}
+	}
+	t.Finished = true
+	if t.Definition.Format == "roundrobin" {
+		if len(t.Standings) > 0 {
+			t.Champion = t.Standings[0].Team
+		}
+	} else if w := t.Matches[len(t.Matches)-1].Winner; w >= 0 {
+		t.Champion = t.Definition.Teams[w].Name
+	}
+}
+
+func tournamentStandingsNOLOCK(t *tournament) []tournamentStanding {
+	ret := make([]tournamentStanding, len(t.Definition.Teams))
+	for i, v := range t.Definition.Teams {
+		ret[i].Team = v.Name
+	}
+	for _, m := range t.Matches {
+		if m.State != tournamentMatchFinished || m.Teams[0] < 0 || m.Teams[1] < 0 {
+			continue
+		}
+		ret[m.Teams[0]].Played++
+		ret[m.Teams[1]].Played++
+		ret[m.Winner].Wins++
+		ret[m.loser()].Losses++
+	}
+	slices.SortStableFunc(ret, func(a, b tournamentStanding) int {
+		if a.Wins != b.Wins {
+			return b.Wins - a.Wins
+		}
+		return a.Losses - b.Losses
+	})
+	return ret
+}
+
+func tournamentCreate(d tournamentDefinition) (*tournament, error) {
+	err := tournamentValidate(d)
+	if err != nil {
+		return nil, err
+	}
+	matches, err := tournamentBuildMatches(d)
+	if err != nil {
+		return nil, err
+	}
+	t := &tournament{
+		Definition: d,
+		Matches:    matches,
+		Created:    time.Now(),
+	}
+	tournamentAdvanceNOLOCK(t)
+	data, err := json.Marshal(t)
+	if err != nil {
+		return nil, err
+	}
+	err = dbpool.QueryRow(context.Background(), `insert into tournaments (name, format, data, finished, created_at, updated_at) values ($1, $2, $3, false, now(), now()) returning id`,
+		d.Name, d.Format, data).Scan(&t.Id)
+	if err != nil {
+		return nil, err
+	}
+	tournamentsLock.Lock()
+	tournaments[t.Id] = t
+	tournamentsLock.Unlock()
+	log.Printf("Created tournament %d %q with %d teams and %d matches", t.Id, d.Name, len(d.Teams), len(matches))
+	return t, tournamentSave(t.Id)
+}
+
+func tournamentSave(id int) error {
+	tournamentsLock.Lock()
+	t, ok := tournaments[id]
+	if !ok {
+		tournamentsLock.Unlock()
+		return errTournamentNotFound
+	}
+	data, err := json.Marshal(t)
+	standings, _ := json.Marshal(t.Standings)
+	finished := t.Finished
+	tournamentsLock.Unlock()
+	if err != nil {
+		return err
+	}
+	_, err = dbpool.Exec(context.Background(), `update tournaments set data = $1, standings = $2, finished = $3, updated_at = now() where id = $4`,
+		data, standings, finished, id)
+	return err
+}
+
+func tournamentSaveResult(t *tournament, m *tournamentMatch) error {
+	_, err := dbpool.Exec(context.Background(), `insert into tournament_matches (tournament, match, bracket, round, team_a, team_b, winner, instance, game, finished_at)
+values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+on conflict (tournament, match) do update set winner = excluded.winner, instance = excluded.instance, game = excluded.game, finished_at = excluded.finished_at`,
+		t.Id, m.Id, m.Bracket, m.Round, t.Definition.Teams[m.Teams[0]].Name, t.Definition.Teams[m.Teams[1]].Name,
+		t.Definition.Teams[m.Winner].Name, m.Instance, m.Game, m.Finished)
+	return err
+}
+
+func tournamentsLoad() {
+	rows, err := dbpool.Query(context.Background(), `select data from tournaments where finished = false`)
+	if err != nil {
+		log.Printf("Failed to load tournaments: %s", err.Error())
+		return
+	}
+	defer rows.Close()
+	tournamentsLock.Lock()
+	defer tournamentsLock.Unlock()
+	for rows.Next() {
+		var data []byte
+		err = rows.Scan(&data)
+		if err != nil {
+			log.Printf("Failed to load tournament: %s", err.Error())
+			continue
+		}
+		t := &tournament{}
+		err = json.Unmarshal(data, t)
+		if err != nil {
+			log.Printf("Failed to load tournament: %s", err.Error())
+			continue
+		}
+		for _, m := range t.Matches {
+			if m.State == tournamentMatchSpawning {
+				m.State = tournamentMatchReady
+			}
+		}
+		tournaments[t.Id] = t
+	}
+	log.Printf("Loaded %d running tournaments", len(tournaments))
+}
+
+func routineTournaments(closechan <-chan struct{}) {
+	tournamentsLoad()
+	for {
+		select {
+		case <-closechan:
+			return
+		case <-time.After(time.Duration(cfg.GetDInt(10, "tournaments", "intervalSeconds")) * time.Second):
+			tournamentsProcess()
+		}
+	}
+}
+
+func tournamentsProcess() {
+	type tournamentSpawn struct {
+		t *tournament
+		m *tournamentMatch
+	}
+	spawns := []tournamentSpawn{}
+	dirty := []int{}
+	maxAttempts := cfg.GetDInt(3, "tournaments", "maxAttempts")
+	tournamentsLock.Lock()
+	for id, t := range tournaments {
+		if t.Finished {
+			delete(tournaments, id)
+			continue
+		}
+		busy := map[int]bool{}
+		running := 0
+		for _, m := range t.Matches {
+			if m.State == tournamentMatchRunning && !isInstanceAlive(m.Instance) {
+				if m.Attempts >= maxAttempts {
+					log.Printf("Tournament %d match %d has no result after %d attempts", t.Id, m.Id, m.Attempts)
+					discordPostError("Tournament %d match %d has no result after %d attempts, set it manually", t.Id, m.Id, m.Attempts)
+					m.State = tournamentMatchDisputed
+				} else {
+					m.State = tournamentMatchReady
+				}
+				dirty = append(dirty, id)
+			}
+			if m.State == tournamentMatchRunning || m.State == tournamentMatchSpawning {
+				busy[m.Teams[0]] = true
+				busy[m.Teams[1]] = true
+				running++
+			}
+		}
+		if !cfg.GetDSBool(false, "allowSpawn") {
+			continue
+		}
+		maxConcurrent := t.Definition.MaxConcurrent
+		if maxConcurrent <= 0 {
+			maxConcurrent = cfg.GetDInt(4, "tournaments", "maxConcurrentMatches")
+		}
+		for _, m := range t.Matches {
+			if running >= maxConcurrent {
+				break
+			}
+			if m.State != tournamentMatchReady || busy[m.Teams[0]] || busy[m.Teams[1]] {
+				continue
+			}
+			m.State = tournamentMatchSpawning
+			busy[m.Teams[0]] = true
+			busy[m.Teams[1]] = true
+			running++
+			spawns = append(spawns, tournamentSpawn{t: t, m: m})
+		}
+	}
+	tournamentsLock.Unlock()
+	for _, s := range spawns {
+		tournamentSpawnMatch(s.t, s.m)
+		dirty = append(dirty, s.t.Id)
+	}
+	for _, id := range removeDuplicate(dirty) {
+		err := tournamentSave(id)
+		if err != nil {
+			log.Printf("Failed to save tournament %d: %s", id, err.Error())
+		}
+	}
+}
+
+func tournamentSpawnMatch(t *tournament, m *tournamentMatch) {
+	tournamentsLock.Lock()
+	d := t.Definition
+	teamA, teamB := d.Teams[m.Teams[0]], d.Teams[m.Teams[1]]
+	mapName := ""
+	if len(d.MapPool) > 0 {
+		mapName = d.MapPool[(m.Round-1+m.Attempts)%len(d.MapPool)]
+	}
+	tournamentsLock.Unlock()
+
+	c := cfg.DupSubTree("queues", d.Queue)
+	for k, v := range d.Settings {
+		c.Set(v, k)
+	}
+	if mapName != "" {
+		cfgRestrictMap(c, mapName)
+	}
+	c.Set(fmt.Sprintf("%s: %s vs %s", d.Name, teamA.Name, teamB.Name), "roomName")
+
+	gi, err := generateInstance(c, d.Queue)
+	tournamentsLock.Lock()
+	defer tournamentsLock.Unlock()
+	m.Attempts++
+	if err != nil {
+		log.Printf("Tournament %d failed to generate instance for match %d: %s", t.Id, m.Id, err.Error())
+		if gi != nil {
+			releaseInstance(gi)
+		}
+		discordPostError("Tournament %d failed to generate instance for match %d: %s", t.Id, m.Id, err.Error())
+		m.State = tournamentMatchReady
+		return
+	}
+	gi.QueueName = ""
+	gi.Origin = "tournament"
+	gi.Access = &instanceAccess{
+		Pubkeys:         []string{},
+		Hashes:          append(slices.Clone(teamA.Hashes), teamB.Hashes...),
+		AllowSpectators: d.AllowSpectators,
+	}
+	m.Instance = gi.Id
+	m.Map = gi.Settings.MapName
+	m.State = tournamentMatchRunning
+	log.Printf("Tournament %d match %d (%s vs %s) spawned instance %d", t.Id, m.Id, teamA.Name, teamB.Name, gi.Id)
+	go spawnRunner(gi)
+}
+
+// called after game was finalized in the database
+func tournamentOnGameEnd(inst *instance, report gamereport.GameReportExtended) {
+	if inst.Origin != "tournament" {
+		return
+	}
+	tournamentsLock.Lock()
+	var t *tournament
+	var m *tournamentMatch
+	for _, tt := range tournaments {
+		for _, mm := range tt.Matches {
+			if mm.Instance == inst.Id && mm.State == tournamentMatchRunning {
+				t, m = tt, mm
+			}
+		}
+	}
+	if m == nil {
+		tournamentsLock.Unlock()
+		inst.logger.Printf("Tournament match for the instance not found")
+		return
+	}
+	winners := []int{}
+	for _, p := range report.PlayerData {
+		if p.PublicKey == "" || p.Usertype != "winner" {
+			continue
+		}
+		hash := pubkeyB64Hash(p.PublicKey)
+		for _, team := range m.Teams {
+			if slices.Contains(t.Definition.Teams[team].Hashes, hash) && !slices.Contains(winners, team) {
+				winners = append(winners, team)
+			}
+		}
+	}
+	if len(winners) != 1 {
+		tournamentsLock.Unlock()
+		inst.logger.Printf("Tournament %d match %d has no clear winner (%v), it will be replayed", t.Id, m.Id, winners)
+		return
+	}
+	m.Winner = winners[0]
+	m.Game = inst.GameId
+	m.State = tournamentMatchFinished
+	m.Finished = time.Now()
+	tournamentAdvanceNOLOCK(t)
+	tournamentsLock.Unlock()
+	inst.logger.Printf("Tournament %d match %d won by %q", t.Id, m.Id, t.Definition.Teams[m.Winner].Name)
+	err := tournamentSaveResult(t, m)
+	if err != nil {
+		inst.logger.Printf("Failed to save tournament match result: %s", err.Error())
+	}
+	err = tournamentSave(t.Id)
+	if err != nil {
+		inst.logger.Printf("Failed to save tournament: %s", err.Error())
+	}
+}
+
+func tournamentSetResult(id, matchID, winner int) error {
+	tournamentsLock.Lock()
+	t, ok := tournaments[id]
+	if !ok {
+		tournamentsLock.Unlock()
+		return errTournamentNotFound
+	}
+	if matchID < 0 || matchID >= len(t.Matches) {
+		tournamentsLock.Unlock()
+		return errTournamentMatch
+	}
+	m := t.Matches[matchID]
+	if m.State == tournamentMatchPending || m.State == tournamentMatchFinished || !slices.Contains(m.Teams[:], winner) {
+		tournamentsLock.Unlock()
+		return errTournamentMatch
+	}
+	m.Winner = winner
+	m.State = tournamentMatchFinished
+	m.Finished = time.Now()
+	tournamentAdvanceNOLOCK(t)
+	tournamentsLock.Unlock()
+	err := tournamentSaveResult(t, m)
+	if err != nil {
+		return err
+	}
+	return tournamentSave(id)
+}
+
+func tournamentSnapshot(id int) ([]byte, error) {
+	tournamentsLock.Lock()
+	t, ok := tournaments[id]
+	if ok {
+		defer tournamentsLock.Unlock()
+		return json.MarshalIndent(t, "", "\t")
+	}
+	tournamentsLock.Unlock()
+	var data []byte
+	err := dbpool.QueryRow(context.Background(), `select data from tournaments where id = $1`, id).Scan(&data)
+	if err != nil {
+		return nil, errTournamentNotFound
+	}
+	return data, nil
+}
+
+func webHandleTournaments(w http.ResponseWriter, r *http.Request) {
+	if idStr := r.URL.Query().Get("id"); idStr != "" {
+		id, err := strconv.Atoi(idStr)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error() + "\n"))
+			return
+		}
+		data, err := tournamentSnapshot(id)
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(err.Error() + "\n"))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(data)
+		w.Write([]byte("\n"))
+		return
+	}
+	type tournamentSummary struct {
+		Id       int
+		Name     string
+		Format   string
+		Finished bool
+		Champion string
+		Created  time.Time
+	}
+	ret := []tournamentSummary{}
+	var s tournamentSummary
+	_, err := dbpool.QueryFunc(context.Background(), `select id, name, format, finished, coalesce(data->>'Champion', ''), created_at from tournaments order by id desc limit 100`,
+		[]any{}, []any{&s.Id, &s.Name, &s.Format, &s.Finished, &s.Champion, &s.Created}, func(_ pgx.QueryFuncRow) error {
+			ret = append(ret, s)
+			return nil
+		})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error() + "\n"))
+		return
+	}
+	webRespondJSON(w, ret)
+}
+
+func webHandleTournamentCreate(w http.ResponseWriter, r *http.Request) {
+	var d tournamentDefinition
+	err := json.NewDecoder(r.Body).Decode(&d)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error() + "\n"))
+		return
+	}
+	t, err := tournamentCreate(d)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error() + "\n"))
+		return
+	}
+	webRespondJSON(w, map[string]any{"id": t.Id})
+}
+
+func webHandleTournamentResult(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Tournament int `json:"tournament"`
+		Match      int `json:"match"`
+		Winner     int `json:"winner"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error() + "\n"))
+		return
+	}
+	err = tournamentSetResult(req.Tournament, req.Match, req.Winner)
+	if err != nil {
+		if errors.Is(err, errTournamentNotFound) || errors.Is(err, errTournamentMatch) {
+			w.WriteHeader(http.StatusBadRequest)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		w.Write([]byte(err.Error() + "\n"))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+// plays tournament out with lower team index always winning
+func playTournament(t *testing.T, format string, teamCount int) *tournament {
+	d := tournamentDefinition{Format: format}
+	for i := range teamCount {
+		d.Teams = append(d.Teams, tournamentTeam{Name: fmt.Sprintf("team%d", i)})
+	}
+	matches, err := tournamentBuildMatches(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := &tournament{Definition: d, Matches: matches}
+	tournamentAdvanceNOLOCK(tr)
+	for range len(matches) + 1 {
+		if tr.Finished {
+			return tr
+		}
+		played := false
+		for _, m := range tr.Matches {
+			if m.State != tournamentMatchReady {
+				continue
+			}
+			m.Winner = min(m.Teams[0], m.Teams[1])
+			m.State = tournamentMatchFinished
+			played = true
+		}
+		if !played {
+			t.Fatalf("%s with %d teams got stuck", format, teamCount)
+		}
+		tournamentAdvanceNOLOCK(tr)
+	}
+	if !tr.Finished {
+		t.Fatalf("%s with %d teams did not finish", format, teamCount)
+	}
+	return tr
+}
+
+func tournamentLosses(tr *tournament) map[int]int {
+	ret := map[int]int{}
+	for _, m := range tr.Matches {
+		if m.Teams[0] >= 0 && m.Teams[1] >= 0 {
+			ret[m.loser()]++
+		}
+	}
+	return ret
+}
+
+func TestTournamentSingleElimination(t *testing.T) {
+	for teamCount := 2; teamCount <= 9; teamCount++ {
+		tr := playTournament(t, "single", teamCount)
+		size := 2
+		for size < teamCount {
+			size *= 2
+		}
+		if len(tr.Matches) != size-1 {
+			t.Errorf("%d teams: %d matches, want %d", teamCount, len(tr.Matches), size-1)
+		}
+		if tr.Champion != "team0" {
+			t.Errorf("%d teams: champion %q", teamCount, tr.Champion)
+		}
+		losses := tournamentLosses(tr)
+		for team := 1; team < teamCount; team++ {
+			if losses[team] != 1 {
+				t.Errorf("%d teams: team %d lost %d times", teamCount, team, losses[team])
+			}
+		}
+	}
+}
+
+func TestTournamentDoubleElimination(t *testing.T) {
+	for teamCount := 3; teamCount <= 9; teamCount++ {
+		tr := playTournament(t, "double", teamCount)
+		if tr.Champion != "team0" {
+			t.Errorf("%d teams: champion %q", teamCount, tr.Champion)
+		}
+		last := tr.Matches[len(tr.Matches)-1]
+		if last.Bracket != "final" {
+			t.Errorf("%d teams: last match is %q", teamCount, last.Bracket)
+		}
+		losses := tournamentLosses(tr)
+		if losses[0] != 0 {
+			t.Errorf("%d teams: champion lost %d times", teamCount, losses[0])
+		}
+		for team := 1; team < teamCount; team++ {
+			if losses[team] < 1 || losses[team] > 2 {
+				t.Errorf("%d teams: team %d lost %d times", teamCount, team, losses[team])
+			}
+		}
+	}
+	// without byes everyone but the champion is out after exactly two losses
+	for _, teamCount := range []int{4, 8, 16} {
+		losses := tournamentLosses(playTournament(t, "double", teamCount))
+		for team := 1; team < teamCount; team++ {
+			if losses[team] != 2 {
+				t.Errorf("%d teams: team %d lost %d times", teamCount, team, losses[team])
+			}
+		}
+	}
+}
+
+func TestTournamentRoundRobin(t *testing.T) {
+	for teamCount := 2; teamCount <= 7; teamCount++ {
+		tr := playTournament(t, "roundrobin", teamCount)
+		if len(tr.Matches) != teamCount*(teamCount-1)/2 {
+			t.Errorf("%d teams: %d matches", teamCount, len(tr.Matches))
+		}
+		pairs := map[[2]int]bool{}
+		for _, m := range tr.Matches {
+			p := [2]int{min(m.Teams[0], m.Teams[1]), max(m.Teams[0], m.Teams[1])}
+			if p[0] == p[1] || pairs[p] {
+				t.Errorf("%d teams: pair %v repeated", teamCount, p)
+			}
+			pairs[p] = true
+		}
+		for _, s := range tr.Standings {
+			if s.Played != teamCount-1 {
+				t.Errorf("%d teams: %s played %d", teamCount, s.Team, s.Played)
+			}
+		}
+		if tr.Champion != "team0" {
+			t.Errorf("%d teams: champion %q", teamCount, tr.Champion)
+		}
+	}
+}
+
+func TestTournamentUnknownFormat(t *testing.T) {
+	_, err := tournamentBuildMatches(tournamentDefinition{Format: "swiss", Teams: make([]tournamentTeam, 4)})
+	if err == nil {
+		t.Error("unknown format was accepted")
+	}
+}
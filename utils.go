@@ -1,10 +1,12 @@
 package main
 
 import (
+	crand "crypto/rand"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"log"
+	"math/big"
 	"math/rand"
 	"os"
 	"strconv"
@@ -157,6 +159,20 @@ func genRandomString(l int) string {
 	return ret
 }
 
+// for anything that must not be guessed
+func genSecureRandomString(l int) string {
+	chars := "abcdefghijkmnopqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	ret := make([]byte, l)
+	for i := range ret {
+		n, err := crand.Int(crand.Reader, big.NewInt(int64(len(chars))))
+		if err != nil {
+			panic(err)
+		}
+		ret[i] = chars[n.Int64()]
+	}
+	return string(ret)
+}
+
 func makeDirs(perm os.FileMode, dirs []string) error {
 	for _, v := range dirs {
 		err := os.MkdirAll(v, perm)
@@ -259,6 +275,26 @@ func roomStatusPlayerSlotToPropertyString(status lac.Conf, slotSearching int, pr
 	return ""
 }
 
+// returns entries of room status players with given type, any type if empty
+func roomStatusPlayersOfType(status lac.Conf, playertype string) []map[string]any {
+	ret := []map[string]any{}
+	pl, ok := status.GetSliceAny("players")
+	if !ok {
+		return ret
+	}
+	for _, v := range pl {
+		p, ok := v.(map[string]any)
+		if !ok {
+			continue
+		}
+		if t, _ := p["type"].(string); playertype != "" && t != playertype {
+			continue
+		}
+		ret = append(ret, p)
+	}
+	return ret
+}
+
 func anyToInt(a any) (int, bool) {
 	switch v := a.(type) {
 	case int:
@@ -5,8 +5,10 @@ import (
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/hex"
+	"fmt"
 	"log"
 	"maps"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -26,31 +28,32 @@ var (
 
 func voteKickOnCommand(inst *instance, args string, e chatCommandExecutor) {
 	targetHash := args
+	lang := msgRoomLang(inst)
 	req := voteKickGetThreshold(inst)
 	if req == 0 {
-		instWriteFmt(inst, `chat bcast ⚠ Votekick is disabled in this room.`)
+		instWriteFmt(inst, `chat bcast %s`, msgT(inst, lang, "votekick.disabled"))
 		return
 	}
 	if !checkPkeyHasAccount(e.publicKey) {
-		instWriteFmt(inst, `chat bcast ⚠ Votekick avaliable only to registered and linked players.`)
-		instWriteFmt(inst, `chat bcast ⚠ Link your identity on https://wz2100-autohost.net/wzlink`)
+		instWriteFmt(inst, `chat bcast %s`, msgT(inst, lang, "votekick.linked"))
+		instWriteFmt(inst, `chat bcast %s`, msgT(inst, lang, "join.linkIdentity"))
 		return
 	}
 	if len(targetHash) < 3 {
-		instWriteFmt(inst, `chat bcast ⚠ Votekick player ID prefix must be at least 3 characters long`)
+		instWriteFmt(inst, `chat bcast %s`, msgT(inst, lang, "votekick.shortID"))
 		return
 	}
 	if !stringOnlyContainsCaseInsensitive(targetHash, "0123456789abcdef") {
-		instWriteFmt(inst, `chat bcast ⚠ Votekick provided player ID prefix is invalid`)
+		instWriteFmt(inst, `chat bcast %s`, msgT(inst, lang, "votekick.invalidID"))
 		return
 	}
-	ip, name := roomLookupHash(inst, targetHash)
+	ip, name, fullHash := roomLookupHash(inst, targetHash)
 	if ip == "" {
-		instWriteFmt(inst, `chat bcast ⚠ Votekick player not found`)
+		instWriteFmt(inst, `chat bcast %s`, msgT(inst, lang, "votekick.notFound"))
 		return
 	}
 	if ip == "multiple" {
-		instWriteFmt(inst, `chat bcast ⚠ Provide longer votekick player ID, collision detected`)
+		instWriteFmt(inst, `chat bcast %s`, msgT(inst, lang, "votekick.collision"))
 		return
 	}
 	vlt := voteKickGetVoteLifetime()
@@ -76,7 +79,7 @@ func voteKickOnCommand(inst *instance, args string, e chatCommandExecutor) {
 			if vtr == "0s" {
 				vtr = "1s"
 			}
-			instWriteFmt(inst, `chat bcast ⚠ Please wait for %s to cast your next vote`, vtr)
+			instWriteFmt(inst, `chat bcast %s`, msgT(inst, lang, "votekick.wait", "duration", vtr))
 			return
 		}
 		voteKickVotes[e.ip] = voteKickVote{
@@ -87,11 +90,17 @@ func voteKickOnCommand(inst *instance, args string, e chatCommandExecutor) {
 	}
 
 	hits := voteKickCheckIPNOLOCK(ip, vlt)
-	instWriteFmt(inst, `chat bcast ⚠ Votekick of player %s (%q): votes %d/%d`, targetHash, strings.ReplaceAll(name, "\n", ""), hits, req)
+	instWriteFmt(inst, `chat bcast %s`, msgT(inst, lang, "votekick.progress", "hash", targetHash, "name", fmt.Sprintf("%q", strings.ReplaceAll(name, "\n", "")),
+		"votes", strconv.Itoa(hits), "required", strconv.Itoa(req)))
 	if hits >= req {
-		instWriteFmt(inst, `ban ip %s You got votekicked. You will be able to join back in %s. If you feel like it is being abused, contact administrators.`, ip, bandur)
+		instWriteFmt(inst, `ban ip %s %s`, ip, msgT(inst, lang, "reject.votekicked", "duration", bandur.String()))
 		instWriteFmt(inst, `unban ip %s`, ip)
 		voteKickRestrictions[ip] = time.Now().Add(bandur)
+		ecode, err := DbLogAction("%d [votekick] Player %q (%s) votekicked for %s with %d votes, ip was %s", inst.Id, name, fullHash, bandur, hits, ip)
+		if err != nil {
+			inst.logger.Printf("Failed to log action in database: %s", err.Error())
+		}
+		moderationNotify(inst, "votekick", name, fullHash, ip, ecode, fmt.Sprintf("Votes %d/%d, restricted for %s", hits, req, bandur))
 	}
 }
 
@@ -130,7 +139,7 @@ func voteKickCheckRestricted(ip string) time.Duration {
 	return time.Until(t)
 }
 
-func roomLookupHash(inst *instance, target string) (ip string, name string) {
+func roomLookupHash(inst *instance, target string) (ip string, name string, hash string) {
 	pl, ok := inst.RoomStatus.GetSliceAny("players")
 	if !ok {
 		inst.logger.Println("votekick room status has no players slice")
@@ -158,6 +167,7 @@ func roomLookupHash(inst *instance, target string) (ip string, name string) {
 				if ok {
 					ip = ipm
 					name, _ = p["name"].(string)
+					hash = hex.EncodeToString(hashBytes[:])
 				} else {
 					inst.logger.Println("votekick ip not found")
 				}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+)
+
+const (
+	webhookEventInstanceCreated  = "instance.created"
+	webhookEventLobbyAssigned    = "instance.lobby"
+	webhookEventGameStarted      = "game.started"
+	webhookEventGameBegun        = "game.begun"
+	webhookEventGameFinalized    = "game.finalized"
+	webhookEventInstanceArchived = "instance.archived"
+)
+
+type webhookEvent struct {
+	Event    string         `json:"event"`
+	Time     time.Time      `json:"time"`
+	Instance map[string]any `json:"instance"`
+	Data     map[string]any `json:"data,omitempty"`
+}
+
+type webhookTarget struct {
+	URL    string   `mapstructure:"url"`
+	Secret string   `mapstructure:"secret"`
+	Events []string `mapstructure:"events"`
+}
+
+var (
+	webhookEvents = make(chan webhookEvent, 1024)
+)
+
+func webhookFire(event string, inst *instance, data map[string]any) {
+	e := webhookEvent{
+		Event: event,
+		Time:  time.Now(),
+		Instance: map[string]any{
+			"id":          inst.Id,
+			"queue":       inst.QueueName,
+			"origin":      inst.Origin,
+			"port":        inst.Settings.GamePort,
+			"map":         inst.Settings.MapName,
+			"mapHash":     inst.Settings.MapHash,
+			"playerCount": inst.Settings.PlayerCount,
+			"lobbyId":     inst.LobbyId,
+			"gameId":      inst.GameId,
+		},
+		Data: data,
+	}
+	select {
+	case webhookEvents <- e:
+	default:
+		inst.logger.Printf("Webhook queue is full, dropping event %s", event)
+	}
+}
+
+func routineWebhookDispatcher(closechan <-chan struct{}) {
+	for {
+		select {
+		case <-closechan:
+			return
+		case e := <-webhookEvents:
+			targets := []webhookTarget{}
+			err := cfg.GetToStruct(&targets, "webhooks")
+			if err != nil {
+				continue
+			}
+			body, err := json.Marshal(e)
+			if err != nil {
+				log.Printf("Failed to marshal webhook event %s: %s", e.Event, err.Error())
+				continue
+			}
+			for _, t := range targets {
+				if len(t.Events) > 0 && !slices.Contains(t.Events, e.Event) {
+					continue
+				}
+				go webhookDeliver(t, e.Event, body)
+			}
+		}
+	}
+}
+
+func webhookSign(secret string, timestamp string, body []byte) string {
+	m := hmac.New(sha256.New, []byte(secret))
+	m.Write([]byte(timestamp))
+	m.Write([]byte("."))
+	m.Write(body)
+	return "sha256=" + hex.EncodeToString(m.Sum(nil))
+}
+
+func webhookDeliver(t webhookTarget, event string, body []byte) {
+	retries := cfg.GetDInt(5, "webhooksRetries")
+	backoff := time.Second * time.Duration(cfg.GetDInt(2, "webhooksRetryDelaySeconds"))
+	c := http.Client{Timeout: 5 * time.Second}
+	var lastErr error
+	for try := 0; try <= retries; try++ {
+		if try > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		req, err := http.NewRequest("POST", t.URL, bytes.NewReader(body))
+		if err != nil {
+			log.Printf("Failed to create webhook request to %q: %s", t.URL, err.Error())
+			return
+		}
+		timestamp := fmt.Sprint(time.Now().Unix())
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Autohoster-Event", event)
+		req.Header.Set("X-Autohoster-Timestamp", timestamp)
+		if t.Secret != "" {
+			req.Header.Set("X-Autohoster-Signature", webhookSign(t.Secret, timestamp, body))
+		}
+		resp, err := c.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+			return
+		}
+		lastErr = fmt.Errorf("status code %d", resp.StatusCode)
+		if resp.StatusCode >= 400 && resp.StatusCode <= 499 && resp.StatusCode != http.StatusTooManyRequests {
+			break
+		}
+	}
+	log.Printf("Failed to deliver webhook %s to %q: %s", event, t.URL, lastErr)
+	discordPostError("Failed to deliver webhook %s to %q: %s", event, t.URL, lastErr)
+}